@@ -0,0 +1,220 @@
+package davai
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sourceVar 是以 `davai` 標籤綁定的路由變數。
+	sourceVar = ""
+	// sourceQuery 是以 `query` 標籤綁定的查詢參數。
+	sourceQuery = "query"
+	// sourceHeader 是以 `header` 標籤綁定的標頭。
+	sourceHeader = "header"
+)
+
+var (
+	// durationType 是 `time.Duration` 的型態，它的底層是 `int64` 但必須以 `time.ParseDuration` 解析。
+	durationType = reflect.TypeOf(time.Duration(0))
+	// textUnmarshalerType 是 `encoding.TextUnmarshaler` 介面的型態。
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// BindError 是 `BindVars` 無法綁定一或多個欄位時所回傳的錯誤，其中包含了所有欄位的錯誤，而不僅是第一個。
+type BindError struct {
+	// Errors 是每個無法綁定的欄位錯誤。
+	Errors []*VarError
+}
+
+// Error 會回傳所有欄位的錯誤訊息。
+func (e *BindError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, v := range e.Errors {
+		messages[i] = v.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is 會回報是否有任何一個欄位的錯誤符合 `target`，例如 `errors.Is(err, ErrVarEmpty)`。
+func (e *BindError) Is(target error) bool {
+	return e.errors().Is(target)
+}
+
+// As 會將第一個符合 `target` 型態的欄位錯誤指派給 `target`，因此也能透過 `errors.As` 取得單個 `*VarError`。
+func (e *BindError) As(target interface{}) bool {
+	return e.errors().As(target)
+}
+
+// errors 會將所有欄位的錯誤轉換成 `multiError`。
+func (e *BindError) errors() multiError {
+	errs := make(multiError, len(e.Errors))
+	for i, v := range e.Errors {
+		errs[i] = v
+	}
+	return errs
+}
+
+// StatusCode 會回傳此錯誤所對應的 HTTP 狀態碼，綁定錯誤總是 400 Bad Request。
+func (e *BindError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// BindVars 會將請求中的變數依照欄位標籤轉換並填入 `dst` 建構體中，`dst` 必須是建構體的指標。
+//
+//	type Input struct {
+//		ID    int           `davai:"id"`
+//		Page  int           `query:"page"`
+//		Tags  []string      `query:"tag"`
+//		Token string        `header:"X-Token"`
+//		Wait  time.Duration `query:"wait"`
+//	}
+//
+// `davai` 標籤會綁定路由變數，`query` 與 `header` 標籤則會綁定查詢參數與標頭。沒有值的欄位會保持原樣，
+// 支援的型態有字串、整數、浮點數、布林值、`time.Duration` 與實作了 `encoding.TextUnmarshaler` 的型態，以及它們的指標與切片。
+// 無法轉換的欄位會全部被收集成一個 `*BindError` 回傳，因此客戶端能夠一次得知所有錯誤的欄位。
+func BindVars(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: got %T", ErrInvalidBindTarget, dst)
+	}
+	b := &binder{
+		vars:   Params(r),
+		query:  r.URL.Query(),
+		header: r.Header,
+	}
+	b.bind(v.Elem())
+	if len(b.errors) != 0 {
+		return &BindError{Errors: b.errors}
+	}
+	return nil
+}
+
+// binder 保存了綁定時的資料來源與所有發生的錯誤。
+type binder struct {
+	vars   RouteParams
+	query  map[string][]string
+	header http.Header
+	errors []*VarError
+}
+
+// bind 會綁定建構體中所有帶有標籤的欄位，並遞迴處理沒有標籤的嵌入建構體。
+func (b *binder) bind(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		source, name, values := b.lookup(field.Tag)
+		if name == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				b.bind(v.Field(i))
+			}
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), values); err != nil {
+			b.errors = append(b.errors, &VarError{
+				Source: source,
+				Name:   name,
+				Value:  strings.Join(values, ","),
+				Type:   field.Type.String(),
+				Err:    err,
+			})
+		}
+	}
+}
+
+// lookup 會依照欄位標籤回傳變數的來源、名稱與值，沒有標籤時名稱會是空字串。
+func (b *binder) lookup(tag reflect.StructTag) (string, string, []string) {
+	if name := tag.Get("davai"); name != "" && name != "-" {
+		if v := b.vars.Get(name); v != "" {
+			return sourceVar, name, []string{v}
+		}
+		return sourceVar, name, nil
+	}
+	if name := tag.Get("query"); name != "" && name != "-" {
+		return sourceQuery, name, b.query[name]
+	}
+	if name := tag.Get("header"); name != "" && name != "-" {
+		return sourceHeader, name, b.header[http.CanonicalHeaderKey(name)]
+	}
+	return "", "", nil
+}
+
+// setField 會將字串值轉換並設置至欄位中，切片欄位會接收所有的值，其他欄位則僅會採用第一個值。
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && !v.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+// setValue 會將單個字串值轉換成欄位的型態並設置至欄位中。
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+	if v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
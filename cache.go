@@ -0,0 +1,119 @@
+package davai
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// defaultCacheSize 是每個方法的比對快取預設能夠保存的網址數量。
+	defaultCacheSize = 1024
+	// maxCachePathLength 是能夠被快取的網址最大長度，過長的網址通常是惡意請求，快取它們只會浪費記憶體。
+	maxCachePathLength = 256
+)
+
+// CacheStats 呈現了路由比對快取的統計資料。
+type CacheStats struct {
+	// Hits 是從快取中取得比對結果的次數。
+	Hits uint64
+	// Misses 是快取中沒有比對結果而必須重新比對的次數。
+	Misses uint64
+	// Size 是目前快取中所保存的網址數量。
+	Size int
+}
+
+// cacheRoute 是被快取的單個比對結果。
+type cacheRoute struct {
+	// path 是被快取的標準化網址。
+	path string
+	// route 是相符的路由。
+	route *Route
+	// params 是擷取到的變數，這是個唯讀資料必須複製來更改。
+	params RouteParams
+}
+
+// cache 是一個有容量上限的 LRU 比對快取，能夠安全地在多個請求之間共用。
+// 只有啟用了 `RegexCache` 的路由才會被保存至快取中，而無相符路由的網址則永遠不會被快取，
+// 這避免了惡意請求透過大量隨機網址擠掉正常的快取內容。
+type cache struct {
+	// hits 是快取命中的次數，必須擺放在最前面以確保 32 位元平台上的對齊。
+	hits uint64
+	// misses 是快取未命中的次數。
+	misses uint64
+	// mutex 保護下列的 LRU 資料。
+	mutex sync.Mutex
+	// size 是快取的容量上限。
+	size int
+	// items 是以網址作為鍵名的快取項目。
+	items map[string]*list.Element
+	// list 是依照最近使用順序排列的快取項目，最前面的是最近使用的項目。
+	list *list.List
+}
+
+// newCache 會建立一個指定容量的比對快取。
+func newCache(size int) *cache {
+	return &cache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		list:  list.New(),
+	}
+}
+
+// get 會從快取中取得指定網址的比對結果，並將變數複製至 `params` 之中。
+func (c *cache) get(path string, params *RouteParams) (*Route, bool) {
+	c.mutex.Lock()
+	e, ok := c.items[path]
+	if !ok {
+		c.mutex.Unlock()
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	c.list.MoveToFront(e)
+	v := e.Value.(*cacheRoute)
+	*params = append((*params)[:0], v.params...)
+	c.mutex.Unlock()
+	atomic.AddUint64(&c.hits, 1)
+	return v.route, true
+}
+
+// set 會將比對結果保存至快取中，若快取已滿則會移除最久未被使用的項目。
+func (c *cache) set(path string, route *Route, params RouteParams) {
+	if len(path) > maxCachePathLength || c.size <= 0 {
+		return
+	}
+	copied := params.Copy()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.items[path]; ok {
+		c.list.MoveToFront(e)
+		e.Value = &cacheRoute{path: path, route: route, params: copied}
+		return
+	}
+	c.items[path] = c.list.PushFront(&cacheRoute{path: path, route: route, params: copied})
+	for c.list.Len() > c.size {
+		e := c.list.Back()
+		c.list.Remove(e)
+		delete(c.items, e.Value.(*cacheRoute).path)
+	}
+}
+
+// purge 會清空快取，這會在路由有所變動時呼叫，以避免回傳過時的比對結果。
+func (c *cache) purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.list.Init()
+}
+
+// stats 會回傳此快取的統計資料。
+func (c *cache) stats() CacheStats {
+	c.mutex.Lock()
+	size := c.list.Len()
+	c.mutex.Unlock()
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Size:   size,
+	}
+}
@@ -0,0 +1,80 @@
+package davai
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// TrailingSlash 是路由器處理網址尾斜線的方式。
+type TrailingSlash int
+
+const (
+	// TrailingSlashIgnore 會忽略網址的尾斜線，因此 `/users/` 與 `/users` 會是相同的路由，這是預設的行為。
+	TrailingSlashIgnore TrailingSlash = iota
+	// TrailingSlashStrict 會嚴格區分尾斜線，`/users/` 僅會符合以尾斜線定義的路由。
+	TrailingSlashStrict
+	// TrailingSlashRedirect 會嚴格區分尾斜線，但當請求的網址僅差在尾斜線時會重新導向至已定義的路由。
+	TrailingSlashRedirect
+)
+
+// CleanPath 是路由器整理不標準網址（例如重複的斜線、`.` 與 `..`）的方式。
+type CleanPath int
+
+const (
+	// CleanPathNone 不會整理網址，這是預設的行為。
+	CleanPathNone CleanPath = iota
+	// CleanPathServe 會整理網址，並在整理後的網址有相符的路由時直接以整理後的網址執行路由。
+	CleanPathServe
+	// CleanPathRedirect 會整理網址，並在整理後的網址有相符的路由時重新導向至該網址。
+	CleanPathRedirect
+)
+
+// Config 是路由器的設定，這會被嵌入於路由器之中，因此也能夠在建立路由器之後透過路由器直接更改。
+// 但 `CaseSensitive` 與 `TrailingSlash` 會影響路由的解析方式，必須在定義路由之前就設置完畢，建議直接傳入 `New`。
+type Config struct {
+	// AutoHead 會讓沒有相對應 HEAD 路由的 HEAD 請求改以 GET 路由回應，
+	// 這會執行相同的中介軟體與處理函式，但是會捨棄回應內容並保留標頭與 `Content-Length`。
+	AutoHead bool
+	// AutoOptions 會讓沒有相對應 OPTIONS 路由的 OPTIONS 請求自動以 `Allow` 標頭回應該路徑所允許的方法，
+	// 回應時會執行全域與該路徑所屬路由群組的中介軟體，因此 `CORS` 中介軟體也能藉此回應預檢請求。
+	AutoOptions bool
+	// CaseSensitive 會讓路由比對區分大小寫，預設的情況下 `/Users` 與 `/users` 會是相同的路由。
+	CaseSensitive bool
+	// TrailingSlash 是處理網址尾斜線的方式，預設為 `TrailingSlashIgnore`。
+	TrailingSlash TrailingSlash
+	// UseRawPath 會以尚未解碼的網址（`URL.EscapedPath`）比對路由，這樣像是 `%2F` 這種經過編碼的斜線就會被視為片段中的內容，
+	// 而不會將片段一分為二。擷取到的變數仍會經過解碼後才透過 `Vars` 回傳。
+	UseRawPath bool
+	// CleanPath 是整理不標準網址的方式，預設為 `CleanPathNone`。
+	CleanPath CleanPath
+	// RedirectStatus 是 `TrailingSlashRedirect` 與 `CleanPathRedirect` 重新導向時所使用的狀態碼，通常是 301 或 308，預設為 301。
+	RedirectStatus int
+	// BaseURL 是路由器的標準網址，例如 `https://example.com` 或是帶有路徑前輟的 `https://example.com/app`，
+	// 這會在以 `BuildURL` 產生絕對網址卻沒有傳入請求時使用。
+	BaseURL string
+	// StrictRoutes 會讓 `Validate`（以及 `Run` 與 `RunTLS`）將 `Conflicts` 所找到的路由衝突視為錯誤，避免路由在不知情的情況下被其他路由隱藏。
+	StrictRoutes bool
+}
+
+// redirectStatus 會回傳重新導向時所使用的狀態碼。
+func (c Config) redirectStatus() int {
+	if c.RedirectStatus == 0 {
+		return http.StatusMovedPermanently
+	}
+	return c.RedirectStatus
+}
+
+// strictSlash 表示是否嚴格區分網址的尾斜線。
+func (c Config) strictSlash() bool {
+	return c.TrailingSlash != TrailingSlashIgnore
+}
+
+// cleanPath 會將網址整理成標準的格式，這會合併重複的斜線並解析 `.` 與 `..`，但會保留原本的尾斜線。
+func cleanPath(p string) string {
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
@@ -0,0 +1,301 @@
+package davai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConflictKind 是路由衝突的種類。
+type ConflictKind int
+
+const (
+	// ConflictDuplicate 表示兩個路由有著完全相同的路徑，其中一個將永遠無法被比對到。
+	ConflictDuplicate ConflictKind = iota
+	// ConflictShadowed 表示路由所能符合的網址全都會先被另一個優先度較高的路由符合，因此永遠無法被比對到。
+	ConflictShadowed
+	// ConflictAmbiguous 表示兩個路由的差異僅在於擷取群組，而部分網址會同時符合兩者，此時僅會由優先度較高的路由接收。
+	ConflictAmbiguous
+)
+
+// String 會回傳衝突種類的名稱。
+func (k ConflictKind) String() string {
+	switch k {
+	case ConflictDuplicate:
+		return "duplicate"
+	case ConflictShadowed:
+		return "shadowed"
+	default:
+		return "ambiguous"
+	}
+}
+
+// Conflict 呈現了兩個路由之間的衝突。
+type Conflict struct {
+	// Kind 是衝突的種類。
+	Kind ConflictKind
+	// Route 是被隱藏（或部分被隱藏）的路由。
+	Route *Route
+	// Winner 是會優先接收請求的路由。
+	Winner *Route
+}
+
+// String 會回傳衝突的說明，例如 `GET /user/{name} is shadowed by GET /user/{id}`。
+func (c Conflict) String() string {
+	switch c.Kind {
+	case ConflictDuplicate:
+		return fmt.Sprintf("%s is a duplicate of %s", c.Route, c.Winner)
+	case ConflictShadowed:
+		return fmt.Sprintf("%s is shadowed by %s", c.Route, c.Winner)
+	default:
+		return fmt.Sprintf("%s is ambiguous with %s", c.Route, c.Winner)
+	}
+}
+
+// Conflicts 會分析所有已定義的路由，並回傳完全重複的路由、因為優先度較高的路由符合其所有網址而永遠無法被比對到的路由，
+// 以及僅差在擷取群組而會互相競爭的路由。靜態路由本來就會優先於動態路由，因此兩者之間並不算是衝突。
+// 分析是以路由的片段推斷的，兩個不同的規則只有在已知它們所能接受的字元毫無交集時（例如內建的 `i` 與 `alpha`）才會被視為不相交，
+// 其餘的（例如 `i` 與 `s`，或是任何自訂規則）都會假設它們能符合相同的內容而被回報為互相競爭。
+func (r *Router) Conflicts() []Conflict {
+	return r.current().conflicts()
+}
+
+// conflicts 會分析此路由表中所有路由之間的衝突。
+func (t *routeTable) conflicts() []Conflict {
+	var conflicts []Conflict
+	methods := make([]string, 0, len(t.methods))
+	for method := range t.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		// 重複的靜態路由會覆蓋先前的路由，因此是先定義的路由無法被比對到。
+		statics := make(map[string]*Route)
+		for i := len(t.routes) - 1; i >= 0; i-- {
+			route := t.routes[i]
+			if route.method != method || !route.isStatic {
+				continue
+			}
+			if winner, ok := statics[route.staticPath()]; ok {
+				conflicts = append(conflicts, Conflict{Kind: ConflictDuplicate, Route: route, Winner: winner})
+				continue
+			}
+			statics[route.staticPath()] = route
+		}
+
+		dynamics := append([]*Route(nil), t.methods[method].dynamics...)
+		sortByPriority(dynamics)
+		for j, route := range dynamics {
+			// 完全被隱藏的路由只需要回報一次，而不需要再列出與其他路由之間的競爭。
+			var ambiguous []Conflict
+			hidden := false
+			for _, winner := range dynamics[:j] {
+				switch {
+				case route.pattern() == winner.pattern():
+					conflicts = append(conflicts, Conflict{Kind: ConflictDuplicate, Route: route, Winner: winner})
+					hidden = true
+				case winner.covers(route):
+					conflicts = append(conflicts, Conflict{Kind: ConflictShadowed, Route: route, Winner: winner})
+					hidden = true
+				case winner.competes(route):
+					ambiguous = append(ambiguous, Conflict{Kind: ConflictAmbiguous, Route: route, Winner: winner})
+				}
+				if hidden {
+					break
+				}
+			}
+			if !hidden {
+				conflicts = append(conflicts, ambiguous...)
+			}
+		}
+	}
+	return conflicts
+}
+
+// pattern 會回傳此路由不包含變數名稱的路徑樣式，樣式相同的路由會符合完全相同的網址。
+func (r *Route) pattern() string {
+	segments := make([]string, len(r.parts))
+	for i, p := range r.parts {
+		if p.isStatic {
+			segments[i] = p.path
+			continue
+		}
+		var rule, optional string
+		if p.isRegExp && p.rule != nil {
+			rule = p.rule.name
+		}
+		if p.isOptional {
+			optional = "?"
+		}
+		segments[i] = p.prefix + "{" + rule + optional + "}" + p.suffix
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// tail 會回傳此路由中 `*` 任意規則的位置，從該位置開始的所有網址片段都會被接受，沒有的話則回傳 -1。
+func (r *Route) tail() int {
+	for i, p := range r.parts {
+		if !p.isAny() {
+			continue
+		}
+		// 只有在前面還有片段，或是它就是唯一的片段時，任意規則才會吃下剩餘的所有片段。
+		if i > 0 || len(r.parts) == 1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// accepts 表示此路由是否能夠符合有 `n` 個片段的網址，並回傳需要逐一比對的片段數量。
+// 根目錄 `/` 會被視為沒有任何片段，這只有在第一個片段是可選的時候才會相符。
+func (r *Route) accepts(n int) (int, bool) {
+	if n == 0 {
+		return 0, len(r.parts) != 0 && r.parts[0].isOptional
+	}
+	if t := r.tail(); t != -1 {
+		return t, n >= t
+	}
+	m := len(r.parts)
+	// 如果下個片段是可選的，那麼網址在此結束也算符合。
+	if n == m || (n < m && r.parts[n].isOptional) {
+		return n, true
+	}
+	return 0, false
+}
+
+// lengths 會回傳需要分析的網址片段數量上限，超過兩個路由的片段數量後結果都會是相同的。
+func lengths(a *Route, b *Route) int {
+	if len(a.parts) > len(b.parts) {
+		return len(a.parts) + 1
+	}
+	return len(b.parts) + 1
+}
+
+// covers 表示此路由是否能符合 `other` 所能符合的所有網址。
+func (r *Route) covers(other *Route) bool {
+	for n := 0; n <= lengths(r, other); n++ {
+		otherPositions, ok := other.accepts(n)
+		if !ok {
+			continue
+		}
+		positions, ok := r.accepts(n)
+		if !ok {
+			return false
+		}
+		for i := 0; i < positions; i++ {
+			// `other` 在此處已經是任意內容，但此路由仍有限制。
+			if i >= otherPositions || !r.parts[i].covers(other.parts[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// competes 表示此路由是否和 `other` 會符合部分相同的網址，且兩者在每個位置上都同樣是靜態片段或擷取群組，
+// 像是 `/user/{id}` 與 `/user/{s:id}`。靜態片段與擷取群組之間本來就有優先順序，因此並不算是競爭。
+func (r *Route) competes(other *Route) bool {
+	for n := 1; n <= lengths(r, other); n++ {
+		positions, ok := r.accepts(n)
+		if !ok {
+			continue
+		}
+		otherPositions, ok := other.accepts(n)
+		if !ok {
+			continue
+		}
+		overlaps := true
+		for i := 0; i < n && overlaps; i++ {
+			// 超出比對範圍的位置是由任意規則所接收的，這被視為一個能接受任何內容的擷取群組。
+			if i >= positions && i >= otherPositions {
+				break
+			}
+			if i >= positions {
+				overlaps = !other.parts[i].isStatic
+				continue
+			}
+			if i >= otherPositions {
+				overlaps = !r.parts[i].isStatic
+				continue
+			}
+			a, b := r.parts[i], other.parts[i]
+			overlaps = a.isStatic == b.isStatic && a.overlaps(b)
+		}
+		if overlaps {
+			return true
+		}
+	}
+	return false
+}
+
+// covers 表示此片段是否能接受 `other` 片段所能接受的所有內容。
+func (p *part) covers(other *part) bool {
+	if p.isStatic {
+		return other.isStatic && p.path == other.path
+	}
+	if other.isStatic {
+		return p.matches(other.path)
+	}
+	if !strings.HasPrefix(other.prefix, p.prefix) || !strings.HasSuffix(other.suffix, p.suffix) {
+		return false
+	}
+	if !p.isRegExp || p.isAny() {
+		return true
+	}
+	return p.rule == other.rule && p.prefix == other.prefix && p.suffix == other.suffix
+}
+
+// overlaps 表示此片段是否和 `other` 片段能接受部分相同的內容。
+// 兩個不同的規則只有在已知它們所能接受的字元毫無交集時才會被視為不相交，否則就會假設它們能接受相同的內容。
+func (p *part) overlaps(other *part) bool {
+	switch {
+	case p.isStatic && other.isStatic:
+		return p.path == other.path
+	case p.isStatic:
+		return other.matches(p.path)
+	case other.isStatic:
+		return p.matches(other.path)
+	}
+	if !strings.HasPrefix(p.prefix, other.prefix) && !strings.HasPrefix(other.prefix, p.prefix) {
+		return false
+	}
+	if !strings.HasSuffix(p.suffix, other.suffix) && !strings.HasSuffix(other.suffix, p.suffix) {
+		return false
+	}
+	if p.isRegExp && other.isRegExp && !p.isAny() && !other.isAny() && p.rule != other.rule {
+		return !p.disjoint(other)
+	}
+	return true
+}
+
+// disjoint 表示此片段的規則和 `other` 片段的規則是否已知不會接受任何相同的字元。
+// 只有在其中一個片段的變數內容必定位於另一個片段的變數內容之中時（前後輟都比較長）才能以字元判斷，
+// 否則兩個變數內容可能分別位於網址片段的不同位置。
+func (p *part) disjoint(other *part) bool {
+	if p.rule.chars == "" || other.rule.chars == "" || strings.ContainsAny(p.rule.chars, other.rule.chars) {
+		return false
+	}
+	longerPrefix := len(p.prefix) >= len(other.prefix)
+	longerSuffix := len(p.suffix) >= len(other.suffix)
+	if len(p.prefix) == len(other.prefix) || len(p.suffix) == len(other.suffix) {
+		return true
+	}
+	return longerPrefix == longerSuffix
+}
+
+// matches 表示此擷取群組是否能接受指定的網址片段。
+func (p *part) matches(component string) bool {
+	if len(component) < len(p.prefix)+len(p.suffix) || !strings.HasPrefix(component, p.prefix) || !strings.HasSuffix(component, p.suffix) {
+		return false
+	}
+	value := component[len(p.prefix) : len(component)-len(p.suffix)]
+	if !p.isRegExp || p.rule == nil {
+		return value != ""
+	}
+	if value == "" && p.isOptional {
+		return true
+	}
+	_, ok := p.check(value, value, false)
+	return ok
+}
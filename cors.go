@@ -0,0 +1,124 @@
+package davai
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig 是跨來源資源共用（CORS）的設定。
+type CORSConfig struct {
+	// AllowOrigins 是允許的來源，`*` 表示允許所有來源，亦可以使用像是 `https://*.example.com` 的萬用字元，
+	// 萬用字元僅會符合單個由英數字與 `-` 組成的主機名稱標籤（或埠號），因此並不會符合 `.`、`/`、`?` 等字元。
+	AllowOrigins []string
+	// AllowOriginPatterns 是允許的來源正規表達式，例如 `^https://[a-z]+\.example\.com$`。
+	AllowOriginPatterns []string
+	// AllowMethods 是允許的方法，如果是空的則會依照該路徑上已經定義的路由方法自動產生。
+	AllowMethods []string
+	// AllowHeaders 是允許的請求標頭，如果是空的則會直接允許預檢請求中所要求的標頭。
+	AllowHeaders []string
+	// ExposeHeaders 是允許客戶端讀取的回應標頭。
+	ExposeHeaders []string
+	// AllowCredentials 表示是否允許請求帶有 Cookie 等憑證。
+	AllowCredentials bool
+	// MaxAge 是預檢請求結果能夠被快取的時間。
+	MaxAge time.Duration
+}
+
+// cors 是依照設定所建立的 CORS 中介軟體。
+type cors struct {
+	// config 是 CORS 設定。
+	config CORSConfig
+	// allowAll 表示是否允許所有來源。
+	allowAll bool
+	// origins 是編譯後的來源規則。
+	origins []*regexp.Regexp
+}
+
+// CORS 會依照傳入的設定建立一個跨來源資源共用的中介軟體，這能透過 `Use` 套用至全域或者是單個路由群組。
+// 中介軟體會直接回應預檢請求，因此通常會搭配 `AutoOptions` 讓路由器自動接受所有路徑的 OPTIONS 請求。
+func CORS(config CORSConfig) func(http.Handler) http.Handler {
+	c := &cors{config: config}
+	for _, v := range config.AllowOrigins {
+		if v == "*" {
+			c.allowAll = true
+			continue
+		}
+		expr := strings.Replace(regexp.QuoteMeta(v), `\*`, `[A-Za-z0-9-]+`, -1)
+		c.origins = append(c.origins, regexp.MustCompile("(?i)^"+expr+"$"))
+	}
+	for _, v := range config.AllowOriginPatterns {
+		c.origins = append(c.origins, regexp.MustCompile(v))
+	}
+	return c.Middleware
+}
+
+// allowOrigin 表示指定的來源是否被允許。
+func (c *cors) allowOrigin(origin string) bool {
+	if c.allowAll {
+		return true
+	}
+	for _, v := range c.origins {
+		if v.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware 會處理 CORS 標頭，預檢請求會在此直接回應而不會繼續呼叫下一個處理函式。
+func (c *cors) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		isPreflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if isPreflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !c.allowOrigin(origin) {
+			if isPreflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 允許憑證的時候不能以 `*` 回應，必須明確地回傳請求的來源。
+		if c.allowAll && !c.config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !isPreflight {
+			if len(c.config.ExposeHeaders) != 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.config.ExposeHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		methods := c.config.AllowMethods
+		if len(methods) == 0 {
+			if v := contextGet(r, allowKey); v != nil {
+				methods = v.([]string)
+			}
+		}
+		if len(methods) != 0 {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		}
+		if len(c.config.AllowHeaders) != 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.config.AllowHeaders, ", "))
+		} else if v := r.Header.Get("Access-Control-Request-Headers"); v != "" {
+			w.Header().Set("Access-Control-Allow-Headers", v)
+		}
+		if c.config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.config.MaxAge/time.Second)))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,51 @@
+package davai
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// headResponseWriter 會在以 GET 路由回應 HEAD 請求時捨棄所有的內容，
+// 但仍會計算內容的長度並在結束時補上 `Content-Length` 標頭，讓 HEAD 與 GET 的標頭保持一致。
+type headResponseWriter struct {
+	http.ResponseWriter
+	// status 是處理函式所設置的狀態碼。
+	status int
+	// length 是處理函式所寫入（並被捨棄）的內容長度。
+	length int
+}
+
+// WriteHeader 僅會記錄狀態碼，真正的標頭會等到 `finish` 時才送出，這樣才能補上內容長度。
+func (w *headResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write 會捨棄寫入的內容並且累計其長度。
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.length += len(b)
+	return len(b), nil
+}
+
+// finish 會在處理函式結束後補上 `Content-Length` 標頭並送出狀態碼。
+func (w *headResponseWriter) finish() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.Header().Get("Content-Length") == "" && bodyAllowed(w.status) {
+		w.Header().Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// bodyAllowed 表示指定的狀態碼是否允許回應內容。
+func bodyAllowed(status int) bool {
+	if status >= 100 && status <= 199 {
+		return false
+	}
+	return status != http.StatusNoContent && status != http.StatusNotModified
+}
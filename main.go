@@ -5,19 +5,47 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
-	// ErrRouteNotFound 表示產生反向路由的時候找不到對象路由。
+	// ErrRouteNotFound 表示產生反向路由的時候找不到對象路由，或是在執行期間替換、移除路由時找不到相符的路由。
 	ErrRouteNotFound = errors.New("davai: the route was not found")
 	// ErrHandlerNotFound 表示無法找到路由的最終處理函式，也許該函式是個 `nil` 指標。
 	ErrHandlerNotFound = errors.New("davai: the handler of the route was not found, it might be a nil pointer")
+	// ErrRuleNotFound 表示路由中使用了尚未定義的規則，規則必須在定義路由之前透過 `Rule` 建立。
+	ErrRuleNotFound = errors.New("davai: the rule used by the route was not found")
+	// ErrInvalidPath 表示路由的路徑格式錯誤，例如不成對的花括號或是重複的變數名稱。
+	ErrInvalidPath = errors.New("davai: the path of the route is malformed")
+	// ErrDuplicateName 表示路由名稱已經被其他路由所使用。
+	ErrDuplicateName = errors.New("davai: the name of the route is already used")
+	// ErrRouteExists 表示在執行期間新增路由時，已經有相同方法且符合完全相同網址的路由，替換路由應該使用 `ReplaceRoute`。
+	ErrRouteExists = errors.New("davai: the route already exists")
+	// ErrRouteConflict 表示啟用了 `StrictRoutes` 並且有路由和其他路由發生衝突。
+	ErrRouteConflict = errors.New("davai: the route conflicts with another route")
+	// ErrRouterFrozen 表示路由器已經透過 `Build` 編譯並凍結，無法再定義新的路由、規則或中介軟體，
+	// 執行期間的路由更動必須改用 `AddRoute`、`ReplaceRoute` 與 `RemoveRoute` 等函式。
+	ErrRouterFrozen = errors.New("davai: the router is frozen and cannot be changed after it was built")
 	// ErrVarNotFound 表示產生反向路由時，必要的網址變數並不存在而無法反向產生該路由。
 	ErrVarNotFound = errors.New("davai: cannot generate the route if the required parameter has no matched variable")
+	// ErrVarMismatch 表示產生反向路由時，傳入的變數不符合該片段的規則，因此產生的路由將無法被比對。
+	ErrVarMismatch = errors.New("davai: cannot generate the route if the variable does not match the rule of the part")
+	// ErrVarEmpty 表示欲以型態取得的路由變數沒有被擷取到，或者是個空的選擇性變數。
+	ErrVarEmpty = errors.New("davai: the variable was not captured or is empty")
+	// ErrInvalidBindTarget 表示傳入 `BindVars` 的目標並不是建構體的指標。
+	ErrInvalidBindTarget = errors.New("davai: the bind target must be a non-nil pointer to a struct")
+	// ErrBaseURLNotFound 表示欲產生絕對網址，但路由器沒有設置 `BaseURL` 而且也沒有傳入請求可供推斷網址。
+	ErrBaseURLNotFound = errors.New("davai: cannot generate the absolute url without the base url or the request")
+	// ErrInvalidURLArgs 表示模板中的 `url` 函式所傳入的參數並不是成對的鍵名與值。
+	ErrInvalidURLArgs = errors.New("davai: the arguments of the url function must be pairs of a string key and a value")
 	// ErrFileNotFound 表示欲提供的靜態檔案並不存在。
 	ErrFileNotFound = errors.New("davai: the file to serve was not found")
 	// ErrDirectoryNotFound 表示欲提供的靜態目錄資料夾並不存在。
@@ -25,79 +53,50 @@ var (
 )
 
 const (
-	varsKey  = "davaiVars"
-	routeKey = "davaiRoute"
+	paramsKey = "davaiParams"
+	routeKey  = "davaiRoute"
+	allowKey  = "davaiAllow"
 )
 
 // Vars 能夠將接收到的路由變數轉換成本地的 `map[string]string` 格式來供存取使用。
 // 如果路由中有選擇性路由，且請求網址中省略了該變數，取得到的變數結果則會是空字串而非 `nil` 值。
+// 這會在第一次呼叫時才依照 `Params` 建立，若不需要 `map` 的話直接使用 `Params` 能夠避免配置額外的記憶體。
 func Vars(r *http.Request) map[string]string {
-	// if route := contextGet(r, routeKey); route != nil {
-	// 	if v := contextGet(r, varsKey); v != nil {
-	// 		vars := v.(map[string]string)
-	// 		for k := range route.(*Route).defaultCaptureVars {
-	// 			if _, ok := vars[k]; !ok {
-	// 				vars[k] = ""
-	// 			}
-	// 		}
-	// 		return vars
-	// 	}
-	// }
-	if rv := contextGet(r, varsKey); rv != nil {
-		return rv.(map[string]string)
+	p := requestParamsOf(r)
+	if p == nil {
+		return nil
 	}
-	return nil
+	p.varsOnce.Do(func() {
+		p.vars = p.params.vars()
+	})
+	return p.vars
 }
 
-// New 會建立一個新的路由器。
-func New() *Router {
+// New 會建立一個新的路由器，可以額外傳入一個設定來更改路由器的行為。
+func New(config ...Config) *Router {
 	r := &Router{
-		routeNames: make(map[string]*Route),
-		rules:      make(map[string]*rule),
-		methodRoutes: map[string]*routes{
-			"GET": {
-				method:  "GET",
-				statics: make(map[string]*Route),
-				caches:  make(map[string]*cacheRoute),
-			},
-			"POST": {
-				method:  "POST",
-				statics: make(map[string]*Route),
-				caches:  make(map[string]*cacheRoute),
-			},
-			"PUT": {
-				method:  "PUT",
-				statics: make(map[string]*Route),
-				caches:  make(map[string]*cacheRoute),
-			},
-			"PATCH": {
-				method:  "PATCH",
-				statics: make(map[string]*Route),
-				caches:  make(map[string]*cacheRoute),
-			},
-			"DELETE": {
-				method:  "DELETE",
-				statics: make(map[string]*Route),
-				caches:  make(map[string]*cacheRoute),
-			},
-			"OPTIONS": {
-				method:  "OPTIONS",
-				statics: make(map[string]*Route),
-				caches:  make(map[string]*cacheRoute),
-			},
-		},
+		rules: make(map[string]*rule),
+	}
+	r.table.Store(newRouteTable())
+	if len(config) != 0 {
+		r.Config = config[0]
 	}
 	r.Group("")
-	r.Rule("*", ".*")
-	r.Rule("i", "[0-9]+")
-	r.Rule("s", "[0-9A-Za-z]+")
+	registerRules(r)
 	r.NoRoute(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(404)
 		w.Write([]byte("404 page not found\n"))
 	})
+	r.NoMethod(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(405)
+		w.Write([]byte("405 method not allowed\n"))
+	})
 	return r
 }
 
+// anyMethods 是 `Any` 所會使用的標準 HTTP 方法。
+var anyMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"}
+
 // routes 是單個方法的所有路由。
 type routes struct {
 	// method 是這個方法的名稱。
@@ -107,25 +106,23 @@ type routes struct {
 	statics map[string]*Route
 	// dynamics 是所有的動態路由。
 	dynamics []*Route
-	//
-	caches map[string]*cacheRoute
-}
-
-type cacheRoute struct {
-	route *Route
-	vars  map[string]string
+	// tree 是依照動態路由所編譯的路由樹，在路由有所變動後會是 `nil` 直到重新編譯。
+	tree *node
+	// cache 是動態路由的比對快取，僅有啟用 `RegexCache` 的路由會被保存。
+	cache *cache
+	// useCache 表示此方法中是否有任何路由啟用了 `RegexCache`。
+	useCache bool
 }
 
 // Router 是路由器本體。
 type Router struct {
+	// Config 是路由器的設定。
+	Config
+
 	// server 是 HTTP 伺服器。
 	server *http.Server
-	// routeNames 是用來存放已命名的路由供之後取得。
-	routeNames map[string]*Route
-	// routes 是現有的全部路由。
-	routes []*Route
-	// methodRoutes 是以不同方法作為鍵名區分的所有路由。
-	methodRoutes map[string]*routes
+	// table 是目前的路由表（`*routeTable`），執行期間的路由更動會替換整個路由表，讓請求不需要取得鎖就能讀取。
+	table atomic.Value
 	// routeGroups 是所有的路由群組。
 	routeGroups []*RouteGroup
 	// middlewares 是全域中介軟體。
@@ -134,8 +131,22 @@ type Router struct {
 	noRouteMiddlewares []middleware
 	// noRouteHandler 是無路由時所會呼叫的處理函式。
 	noRouteHandler func(w http.ResponseWriter, r *http.Request)
+	// noMethodMiddlewares 是路徑存在但方法不被允許時的中介軟體。
+	noMethodMiddlewares []middleware
+	// noMethodHandler 是路徑存在但方法不被允許時所會呼叫的處理函式。
+	noMethodHandler func(w http.ResponseWriter, r *http.Request)
+	// noRouteChain 是編譯時就已經串連好中介軟體的無路由處理函式。
+	noRouteChain http.Handler
+	// noMethodChain 是編譯時就已經串連好中介軟體的方法不被允許處理函式。
+	noMethodChain http.Handler
 	// rules 用來存放所有的正規表達式規則。
 	rules map[string]*rule
+	// built 表示路由器是否已經編譯並凍結，這會以 `atomic` 讀取，讓請求不需要每次都取得鎖。
+	built uint32
+	// buildErr 是最近一次編譯失敗的錯誤（`buildError`），讓之後的請求不需要取得鎖並重新編譯就能直接發生 panic。
+	buildErr atomic.Value
+	// mutex 確保路由器只會被編譯一次，並讓執行期間的路由更動依序進行，請求則永遠不需要取得此鎖。
+	mutex sync.Mutex
 }
 
 // ServeFile 能夠提供某個靜態檔案，其中可以安插中介軟體，而最後一個參數必須是字串來表示檔案的相對位置。
@@ -236,51 +247,91 @@ func (r *Router) Options(path string, handlers ...interface{}) *Route {
 	return r.routeGroups[0].Options(path, handlers...)
 }
 
+// Head 會依照 HEAD 方法建立相對應的路由。
+func (r *Router) Head(path string, handlers ...interface{}) *Route {
+	return r.routeGroups[0].Head(path, handlers...)
+}
+
+// Connect 會依照 CONNECT 方法建立相對應的路由。
+func (r *Router) Connect(path string, handlers ...interface{}) *Route {
+	return r.routeGroups[0].Connect(path, handlers...)
+}
+
+// Trace 會依照 TRACE 方法建立相對應的路由。
+func (r *Router) Trace(path string, handlers ...interface{}) *Route {
+	return r.routeGroups[0].Trace(path, handlers...)
+}
+
+// Handle 會依照指定的方法建立相對應的路由，這能用來建立如 WebDAV 的 PROPFIND、MKCOL 等自訂方法的路由。
+// 方法名稱會區分大小寫，如同 HTTP 標準所定義的那樣。
+func (r *Router) Handle(method string, path string, handlers ...interface{}) *Route {
+	return r.routeGroups[0].Handle(method, path, handlers...)
+}
+
+// Any 會替所有標準的 HTTP 方法建立相對應的路由。
+func (r *Router) Any(path string, handlers ...interface{}) []*Route {
+	return r.routeGroups[0].Any(path, handlers...)
+}
+
+// Match 會替傳入的每個方法建立相對應的路由。
+func (r *Router) Match(methods []string, path string, handlers ...interface{}) []*Route {
+	return r.routeGroups[0].Match(methods, path, handlers...)
+}
+
 // Generate 可以依照傳入的路由名稱與變數來反向產生定義好的路由，這在用於產生模板連結上非常有用。
-// 當路由中有必要的變數但卻無傳入時會發生 `ErrVarNotFound` 錯誤，如果沒有指定的命名路由則會是 `ErrRouteNotFound` 錯誤。
+// 這是 `URL` 的便捷用法，當無法產生路由時會直接以 `URL` 所回傳的錯誤發生 panic。
 func (r *Router) Generate(name string, params ...map[string]string) string {
-	v, ok := r.routeNames[name]
-	if !ok {
-		panic(ErrRouteNotFound)
-	}
-	// 如果沒有傳入變數的話。
-	var path string
-	if len(params) == 0 {
-		for _, part := range v.parts {
-			if part.name != "" {
-				panic(ErrVarNotFound)
-			}
-			path += fmt.Sprintf("/%s", part.path)
-		}
-		return path
-	}
-	// 如果有傳入變數的話就依照路由片段的要求找出對應的變數值。
-	for _, part := range v.parts {
-		if part.name == "" {
-			path += fmt.Sprintf("/%s", part.path)
-		} else {
-			if v, ok := params[0][part.name]; ok {
-				path += fmt.Sprintf("/%s", v)
-			} else {
-				panic(ErrVarNotFound)
-			}
-		}
+	path, err := r.URL(name, params...)
+	if err != nil {
+		panic(err)
 	}
 	return path
 }
 
+// URL 可以依照傳入的路由名稱與變數來反向產生定義好的路由，並在無法產生時回傳錯誤而不是發生 panic。
+// 產生時會保留片段的前後輟，省略沒有傳入的選擇性變數，而傳入的變數會經過網址編碼，因此變數中的空白等字元並不會破壞路由的結構。
+// 當路由中有必要的變數但卻無傳入時會回傳 `ErrVarNotFound` 錯誤，變數不符合該片段的規則時會是 `ErrVarMismatch` 錯誤，
+// 變數中帶有 `/` 也會被視為不符合（任意規則與 `UseRawPath` 除外），因為解碼後的 `/` 會讓產生的路由無法再次被比對，
+// 會產生 `.` 或 `..` 片段的變數同樣不符合，因為瀏覽器會將其解析成其他的路徑。省略位於中間的選擇性變數則會留下空白的片段（例如 `/a//b`），
+// 這樣的網址在 `CleanPath` 時仍會以原本的網址比對，因此同樣能和路由相符。
+// 如果沒有指定的命名路由則會是 `ErrRouteNotFound` 錯誤，這些錯誤都會帶有路由與變數的名稱，並且能以 `errors.Is` 判斷。
+func (r *Router) URL(name string, params ...map[string]string) (string, error) {
+	var vars map[string]string
+	if len(params) != 0 {
+		vars = params[0]
+	}
+	return r.BuildURL(name, URLOptions{Vars: vars})
+}
+
 // Rule 能夠在路由器中建立一組新的正規表達式規則供在路由中使用。
-func (r *Router) Rule(name string, expr string) {
+// 可以額外傳入一個轉換函式，這會在正規表達式相符之後進一步驗證變數，並將轉換後的值透過 `Values` 提供給處理函式。
+func (r *Router) Rule(name string, expr string, convert ...Converter) {
+	r.mutable()
 	expr = fmt.Sprintf("^%s$", expr)
-	r.rules[name] = &rule{
+	v := &rule{
 		name:   name,
 		expr:   expr,
 		regexp: regexp.MustCompile(expr),
 	}
+	if len(convert) != 0 {
+		v.convert = convert[0]
+	}
+	r.rules[name] = v
+}
+
+// RuleFunc 能夠在路由器中建立一組僅以轉換函式驗證的規則，這在能以 `strconv` 等函式驗證時比正規表達式還要來得快。
+// 轉換後的值能在處理函式中透過 `Values` 取得。
+func (r *Router) RuleFunc(name string, convert Converter) {
+	r.mutable()
+	r.rules[name] = &rule{
+		name:    name,
+		convert: convert,
+	}
 }
 
 // Group 會建立新的路由群組，群組內的路由會共享前輟與中介軟體。
 func (r *Router) Group(path string, middlewares ...interface{}) *RouteGroup {
+	r.mutable()
 	group := &RouteGroup{
 		router: r,
 		prefix: path,
@@ -292,6 +343,7 @@ func (r *Router) Group(path string, middlewares ...interface{}) *RouteGroup {
 
 // NoRoute 會將傳入的處理函式作為無相對路由時的執行函式。
 func (r *Router) NoRoute(handlers ...interface{}) {
+	r.mutable()
 	for _, v := range handlers {
 		switch t := v.(type) {
 		// 中介軟體。
@@ -307,30 +359,74 @@ func (r *Router) NoRoute(handlers ...interface{}) {
 	}
 }
 
+// NoMethod 會將傳入的處理函式作為路徑存在但請求方法不被允許時的執行函式。
+// 在呼叫此函式之前，路由器就已經將允許的方法設置於 `Allow` 標頭中。
+func (r *Router) NoMethod(handlers ...interface{}) {
+	r.mutable()
+	for _, v := range handlers {
+		switch t := v.(type) {
+		// 中介軟體。
+		case func(http.Handler) http.Handler:
+			r.noMethodMiddlewares = append(r.noMethodMiddlewares, middlewareFunc(t))
+		// 進階中介軟體。
+		case middleware:
+			r.noMethodMiddlewares = append(r.noMethodMiddlewares, t)
+		// 處理函式。
+		case func(w http.ResponseWriter, r *http.Request):
+			r.noMethodHandler = t
+		}
+	}
+}
+
 // sortMiddlewares 會重新整理路由中的所有中介軟體並將其安插到每個路由的執行函式鏈中。
 func (r *Router) sortMiddlewares() {
-	for _, route := range r.routes {
-		// 先套用全域中介軟體。
-		route.middlewares = r.middlewares
-		// 接著套用路由群組的中介軟體。
-		route.middlewares = append(route.middlewares, route.routeGroup.middlewares...)
-		// 然後才是本路由的中介軟體與處理函式。
-		for _, v := range route.rawHandlers {
-			switch t := v.(type) {
-			// 中介軟體。
-			case func(http.Handler) http.Handler:
-				route.middlewares = append(route.middlewares, middlewareFunc(t))
-			// 進階中介軟體。
-			case middleware:
-				route.middlewares = append(route.middlewares, t)
-			// 處理函式。
-			case func(http.ResponseWriter, *http.Request):
-				route.handler = http.HandlerFunc(t)
-			case http.Handler:
-				route.handler = t
-			}
+	for _, route := range r.current().routes {
+		r.compose(route)
+	}
+	r.noRouteChain = chain(r.noRouteMiddlewares, http.HandlerFunc(r.noRouteHandler))
+	r.noMethodChain = chain(r.noMethodMiddlewares, http.HandlerFunc(r.noMethodHandler))
+	for _, group := range r.routeGroups {
+		middlewares := append(append([]middleware{}, r.middlewares...), group.middlewares...)
+		group.optionsChain = chain(middlewares, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+}
+
+// compose 會依照全域、路由群組與路由本身的順序整理單個路由的中介軟體，並將其串連成執行函式鏈。
+func (r *Router) compose(route *Route) {
+	// 先套用全域中介軟體。
+	route.middlewares = append([]middleware{}, r.middlewares...)
+	// 接著套用路由群組的中介軟體。
+	route.middlewares = append(route.middlewares, route.routeGroup.middlewares...)
+	// 然後才是本路由的中介軟體與處理函式。
+	for _, v := range route.rawHandlers {
+		switch t := v.(type) {
+		// 中介軟體。
+		case func(http.Handler) http.Handler:
+			route.middlewares = append(route.middlewares, middlewareFunc(t))
+		// 進階中介軟體。
+		case middleware:
+			route.middlewares = append(route.middlewares, t)
+		// 處理函式。
+		case func(http.ResponseWriter, *http.Request):
+			route.handler = http.HandlerFunc(t)
+		case http.Handler:
+			route.handler = t
 		}
 	}
+	// 中介軟體鏈只會在此組合一次，之後的每個請求都會重複使用。
+	if route.handler != nil {
+		route.chain = chain(route.middlewares, route.handler)
+	}
+}
+
+// chain 會以中介軟體由外而內地包裹處理函式，組合成單個處理函式。
+func chain(middlewares []middleware, handler http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i].Middleware(handler)
+	}
+	return handler
 }
 
 // Run 能夠以 HTTP 開始執行路由器服務，若無指定的埠口則會採用預設的 `:8080` 位置。
@@ -348,16 +444,17 @@ func (r *Router) Run(addr ...string) error {
 		// IdleTimeout:  time.Second * 60,
 		Handler: r,
 	}
-	r.sortMiddlewares()
-	r.sortRoutes()
+	if err := r.Build(); err != nil {
+		return err
+	}
 	return r.server.ListenAndServe()
 }
 
 // sortRoutes 會在啟動之前重新整理路由的優先度，因為路由的優先度可能會在之前透過人工干預。
+// 排序完畢後會依照新的順序重新編譯每個方法的路由樹。
 func (r *Router) sortRoutes() {
-	for _, v := range r.routes {
-		// 依照優先度重新排序動態路由。
-		v.routeGroup.router.sort(v.method)
+	for _, v := range r.current().methods {
+		v.compile()
 	}
 }
 
@@ -370,8 +467,9 @@ func (r *Router) RunTLS(addr string, certFile string, keyFile string) error {
 		// IdleTimeout:  time.Second * 60,
 		Handler: r,
 	}
-	r.sortMiddlewares()
-	r.sortRoutes()
+	if err := r.Build(); err != nil {
+		return err
+	}
 	return r.server.ListenAndServeTLS(certFile, keyFile)
 }
 
@@ -380,13 +478,57 @@ func (r *Router) Shutdown(ctx context.Context) error {
 	return r.server.Shutdown(ctx)
 }
 
-// ServeHTTP 會處理所有的請求，並分發到指定的路由。
+// Build 會驗證並編譯所有的路由與中介軟體，之後路由器就會被凍結，再定義新的路由、規則或中介軟體都會發生 `ErrRouterFrozen` panic。
+// `Run` 與 `RunTLS` 會自動呼叫此函式，而將路由器作為 `http.Handler` 掛載至其他伺服器（或是 `httptest`）時，
+// 第一個請求也會自動編譯路由器，但建議先手動呼叫此函式，這樣才能在開始服務之前取得 `Validate` 的錯誤。
+// 此函式能夠安全地在多個 Goroutine 中呼叫，且路由器只會被編譯一次。
+func (r *Router) Build() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if atomic.LoadUint32(&r.built) == 1 {
+		return nil
+	}
+	if err := r.Validate(); err != nil {
+		r.buildErr.Store(buildError{err})
+		return err
+	}
+	r.sortMiddlewares()
+	r.sortRoutes()
+	r.buildErr.Store(buildError{})
+	atomic.StoreUint32(&r.built, 1)
+	return nil
+}
+
+// buildError 包裝了編譯失敗的錯誤，因為 `atomic.Value` 無法保存 `nil`。
+type buildError struct {
+	err error
+}
+
+// mutable 會在路由器已經被凍結時發生 `ErrRouterFrozen` panic。
+func (r *Router) mutable() {
+	if atomic.LoadUint32(&r.built) == 1 {
+		panic(ErrRouterFrozen)
+	}
+}
+
+// ServeHTTP 會處理所有的請求，並分發到指定的路由。尚未編譯的路由器會在此自動編譯，
+// 若編譯時有 `Validate` 錯誤則會以該錯誤發生 panic，因為此時的路由表並不完整。
+// 編譯失敗的錯誤會被保存下來，之後的請求都會直接以相同的錯誤發生 panic 而不會重新編譯，直到再次手動呼叫 `Build` 為止。
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if atomic.LoadUint32(&r.built) == 0 {
+		if v, ok := r.buildErr.Load().(buildError); ok && v.err != nil {
+			panic(v.err)
+		}
+		if err := r.Build(); err != nil {
+			panic(err)
+		}
+	}
 	r.dispatch(w, req)
 }
 
 // Use 能將傳入的中介軟體作為全域中介軟體在所有路由中使用。
 func (r *Router) Use(middlewares ...interface{}) *Router {
+	r.mutable()
 	for _, v := range middlewares {
 		switch t := v.(type) {
 		// 中介軟體。
@@ -400,159 +542,413 @@ func (r *Router) Use(middlewares ...interface{}) *Router {
 	return r
 }
 
+// CacheStats 會回傳所有方法的路由比對快取統計資料總和。
+func (r *Router) CacheStats() CacheStats {
+	var stats CacheStats
+	for _, v := range r.current().methods {
+		s := v.cache.stats()
+		stats.Hits += s.Hits
+		stats.Misses += s.Misses
+		stats.Size += s.Size
+	}
+	return stats
+}
+
 // call 會呼叫指定路由的處理函式，當沒有指定的處理函式時會發生 `ErrHandlerNotFound` 錯誤。
 func (r *Router) call(route *Route, w http.ResponseWriter, req *http.Request) {
-	if route.handler == nil {
+	if route.chain == nil {
 		panic(ErrHandlerNotFound)
 	}
-	var handler http.Handler
-	handler = route.handler
+	route.chain.ServeHTTP(w, req)
+}
+
+// callNoRoute 會呼叫已串連中介軟體的無路由函式。
+func (r *Router) callNoRoute(w http.ResponseWriter, req *http.Request) {
+	r.noRouteChain.ServeHTTP(w, req)
+}
 
-	middlewareLength := len(route.middlewares)
-	for i := middlewareLength - 1; i >= 0; i-- {
-		handler = route.middlewares[i].Middleware(handler)
+// callNoMethod 會設置 `Allow` 標頭，接著呼叫已串連中介軟體的方法不被允許函式。
+func (r *Router) callNoMethod(allowed []string, w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	r.noMethodChain.ServeHTTP(w, req)
+}
+
+// path 會將請求網址整理成比對時所使用的標準路徑，以及保留原始大小寫的路徑。
+// 比對時會使用（不區分大小寫時為小寫的）標準路徑，而擷取變數時則會從原始路徑中取得內容。
+func (r *Router) path(req *http.Request) (string, string) {
+	return r.canonical(r.requestPath(req))
+}
+
+// requestPath 會回傳請求中用來比對路由的網址，啟用 `UseRawPath` 時會是尚未解碼的網址。
+func (r *Router) requestPath(req *http.Request) string {
+	if r.UseRawPath {
+		return escapeSegments(req.URL.EscapedPath())
 	}
-	handler.ServeHTTP(w, req)
+	return req.URL.Path
 }
 
-// callNoRoute 會串連中介軟體並且呼叫無路由的函式。
-func (r *Router) callNoRoute(w http.ResponseWriter, req *http.Request) {
-	var handler http.Handler
-	handler = http.HandlerFunc(r.noRouteHandler)
+// escapeSegments 會將路徑中的每個片段轉換成統一的網址編碼格式，
+// 這讓以不同方式編碼的相同內容（例如 `%C3%A9` 與 `é`）能夠被視為相同的片段，而 `%2F` 則仍會保持編碼。
+func escapeSegments(path string) string {
+	segments := strings.Split(path, "/")
+	for i, v := range segments {
+		if unescaped, err := url.PathUnescape(v); err == nil {
+			v = unescaped
+		}
+		segments[i] = url.PathEscape(v)
+	}
+	return strings.Join(segments, "/")
+}
 
-	middlewareLength := len(r.noRouteMiddlewares)
-	for i := middlewareLength - 1; i >= 0; i-- {
-		handler = r.noRouteMiddlewares[i].Middleware(handler)
+// setPath 會以比對路由時所使用的網址格式更改指定網址的路徑。
+func (r *Router) setPath(u *url.URL, path string) {
+	if !r.UseRawPath {
+		u.Path = path
+		u.RawPath = ""
+		return
+	}
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		unescaped = path
 	}
-	handler.ServeHTTP(w, req)
+	u.Path = unescaped
+	u.RawPath = path
 }
 
-// match 會逐一檢查路由並比對是否和請求網址相符。
-func (r *Router) match(routes *routes, w http.ResponseWriter, req *http.Request) bool {
-	url := req.URL.Path
-	if req.URL.Path != "/" {
-		url = strings.ToLower(strings.TrimRight(req.URL.Path, "/"))
+// canonical 會將指定的網址整理成比對時所使用的標準路徑，以及保留原始大小寫的路徑。
+func (r *Router) canonical(raw string) (string, string) {
+	if raw != "/" && !r.strictSlash() {
+		raw = strings.TrimRight(raw, "/")
 	}
-	if route, ok := routes.statics[url]; ok {
-		r.call(route, w, req)
-		return true
+	return r.normalize(raw), raw
+}
+
+// exists 表示指定的網址是否有能夠回應此請求方法的路由。
+func (r *Router) exists(t *routeTable, req *http.Request, path string) bool {
+	v, ok := t.methods[req.Method]
+	if !ok && req.Method == "HEAD" && r.AutoHead {
+		v, ok = t.methods["GET"]
+	}
+	if !ok {
+		return false
+	}
+	url, raw := r.canonical(path)
+	if raw == "" {
+		return false
+	}
+	return r.find(v, url, raw, nil, nil) != nil
+}
+
+// redirectTo 會將請求重新導向至指定的網址，並保留原本的查詢字串。
+// 以多個斜線開頭的網址（例如 `//evil.com/`）會被瀏覽器視為指向其他主機的網址，因此開頭的斜線會被合併成單個斜線。
+func (r *Router) redirectTo(w http.ResponseWriter, req *http.Request, path string) {
+	if strings.HasPrefix(path, "//") {
+		path = "/" + strings.TrimLeft(path, "/")
+	}
+	u := *req.URL
+	r.setPath(&u, path)
+	http.Redirect(w, req, u.RequestURI(), r.redirectStatus())
+}
+
+// clean 會依照設定整理不標準的請求網址，並回傳整理後的請求。如果已經重新導向的話則會回傳 `nil`。
+// 只有在整理後的網址有相符的路由時才會使用整理後的網址，否則就以原本的請求比對，這讓僅有原始網址相符的路由仍能被呼叫。
+func (r *Router) clean(t *routeTable, w http.ResponseWriter, req *http.Request) *http.Request {
+	// 像是 `OPTIONS *` 這種並非以斜線開頭的網址不需要整理。
+	path := r.requestPath(req)
+	if r.CleanPath == CleanPathNone || !strings.HasPrefix(path, "/") {
+		return req
+	}
+	cleaned := cleanPath(path)
+	if cleaned == path {
+		return req
+	}
+	if !r.exists(t, req, cleaned) {
+		return req
+	}
+	if r.CleanPath == CleanPathRedirect {
+		r.redirectTo(w, req, cleaned)
+		return nil
+	}
+	u := *req.URL
+	r.setPath(&u, cleaned)
+	cleanedReq := new(http.Request)
+	*cleanedReq = *req
+	cleanedReq.URL = &u
+	return cleanedReq
+}
+
+// normalize 會依照路由器是否區分大小寫來將路徑轉換成比對時所使用的格式。
+func (r *Router) normalize(path string) string {
+	if r.CaseSensitive {
+		return path
+	}
+	return toLower(path)
+}
+
+// toLower 會將字串轉換成小寫，但轉換後位元組長度會改變的字元（例如克氏度符號 U+212A）則會保持原樣，
+// 這讓小寫的網址片段與原始網址片段的每個位置都能互相對應，擷取變數時就能夠直接從原始網址片段取得原本的大小寫。
+func toLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return toLowerUnicode(s)
+		}
+	}
+	return strings.ToLower(s)
+}
+
+// toLowerUnicode 是 `toLower` 處理非 ASCII 字串的方式，無效的 UTF-8 位元組也會保持原樣。
+func toLowerUnicode(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if l := unicode.ToLower(r); r != utf8.RuneError && utf8.RuneLen(l) == size {
+			b.WriteRune(l)
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
 	}
-	//if route, ok := routes.caches[url]; ok {
-	//	r.call(route.route, w, contextSet(req, varsKey, route.vars))
-	//	return true
-	//}
+	return b.String()
+}
 
-	components := strings.Split(url, "/")[1:]
-	componentLength := len(components)
-	if componentLength == 0 {
+// segment 會將路由中的靜態內容轉換成比對時所使用的格式，使用 `UseRawPath` 時會和請求網址一樣經過網址編碼。
+func (r *Router) segment(path string) string {
+	if r.UseRawPath {
+		path = escapeSegments(path)
+	}
+	return r.normalize(path)
+}
+
+// redirect 會在請求網址僅差在尾斜線時，重新導向至已定義的路由。
+func (r *Router) redirect(t *routeTable, w http.ResponseWriter, req *http.Request) bool {
+	current := r.requestPath(req)
+	if r.TrailingSlash != TrailingSlashRedirect || current == "/" {
 		return false
 	}
+	path := current + "/"
+	if strings.HasSuffix(current, "/") {
+		path = strings.TrimRight(current, "/")
+	}
+	if !r.exists(t, req, path) {
+		return false
+	}
+	r.redirectTo(w, req, path)
+	return true
+}
 
-	for _, route := range routes.dynamics {
-		var matched bool
-		vars := make(map[string]string)
-		for k, v := range route.defaultCaptureVars {
-			vars[k] = v
+// find 會以標準路徑尋找相符的路由，靜態路由會率先比對，若無相符的路由才會搜尋動態路由。
+// 擷取到的變數會被寫入 `params` 之中，規則的轉換結果則會被寫入 `values`，不需要時都能夠傳入 `nil`。
+// 從快取取得的結果並不會有轉換結果，而是交由 `Values` 在需要時才轉換。
+func (r *Router) find(routes *routes, path string, raw string, params *RouteParams, values *[]conversion) *Route {
+	if params == nil {
+		params = new(RouteParams)
+	}
+	*params = (*params)[:0]
+	if route, ok := routes.statics[path]; ok {
+		return route
+	}
+	// 擷取的變數會保留原始的大小寫，因此快取必須以原始路徑作為鍵名。
+	if routes.useCache {
+		if route, ok := routes.cache.get(raw, params); ok {
+			return route
 		}
-		partLength := len(route.parts)
-
-	partScan:
-		for index, part := range route.parts {
-			component := components[index]
-			isLastComponent := index == componentLength-1
-			isLastPart := index == partLength-1
-
-			switch {
-			case part.isStatic:
-				if part.path != component {
-					break partScan
-				}
-			case part.isCaptureGroup:
-				if part.prefix != "" {
-					if !strings.HasPrefix(component, part.prefix) {
-						break partScan
-					}
-					component = strings.TrimPrefix(component, part.prefix)
-				}
-				if part.suffix != "" {
-					if !strings.HasSuffix(component, part.suffix) {
-						break partScan
-					}
-					component = strings.TrimSuffix(component, part.suffix)
-				}
-				if part.prefix != "" || part.suffix != "" {
-					if !part.isOptional && !part.isRegExp && component == "" {
-						break partScan
-					}
-				}
-				if part.isRegExp {
-					if part.rule.name == "*" {
-						if isLastPart {
-							vars[part.name] = strings.Join(components[index:], "/")
-							matched = true
-							break partScan
-						}
-					}
-					if (part.isOptional && component != "") || !part.isOptional {
-						if !part.rule.regexp.MatchString(component) {
-							break partScan
-						}
-					}
-				}
-				vars[part.name] = component
-			}
-			if !isLastPart {
-				if component != "" {
-					nextPart := route.parts[index+1]
-					if nextPart.isOptional {
-						if isLastComponent {
-							matched = true
-							break
-						}
-					}
-					if nextPart.isRegExp {
-						if nextPart.rule.name == "*" {
-							vars[nextPart.name] = strings.Join(components[index+1:], "/")
-							matched = true
-							break partScan
-						}
-					}
-				}
-			}
-			if isLastPart && isLastComponent {
-				matched = true
-				break
-			}
-			if isLastComponent {
-				break
+	}
+	s := segmentsPool.Get().(*segments)
+	s.components = splitPath(s.components[:0], path)
+	s.originals = splitPath(s.originals[:0], raw)
+	route := routes.lookup(s.components, s.originals, params, values)
+	s.components, s.originals = s.components[:0], s.originals[:0]
+	segmentsPool.Put(s)
+	if route == nil {
+		return nil
+	}
+	// 以尚未解碼的網址比對時，擷取到的變數需要經過解碼才是真正的內容。
+	if r.UseRawPath {
+		for i, v := range *params {
+			if unescaped, err := url.PathUnescape(v.Value); err == nil {
+				(*params)[i].Value = unescaped
 			}
 		}
-		if matched {
-			//routes.caches[url] = &cacheRoute{
-			//	route: route,
-			//	vars:  vars,
-			//}
-			r.call(route, w, contextSet(req, varsKey, vars))
-			return true
+	}
+	if routes.useCache && route.RegexCache {
+		routes.cache.set(raw, route, *params)
+	}
+	return route
+}
+
+// segments 是比對動態路由時重複使用的網址片段，擷取到的變數是取自網址字串本身，因此片段切片能夠在比對之後立即放回 `segmentsPool`。
+type segments struct {
+	components []string
+	originals  []string
+}
+
+// segmentsPool 是重複使用的網址片段。
+var segmentsPool = sync.Pool{
+	New: func() interface{} {
+		return new(segments)
+	},
+}
+
+// splitPath 會將路徑中第一個 `/` 之後的片段附加至 `dst` 之中，結果與 `strings.Split(path, "/")[1:]` 相同但不需要配置新的切片。
+func splitPath(dst []string, path string) []string {
+	i := strings.IndexByte(path, '/')
+	if i == -1 {
+		return dst
+	}
+	path = path[i+1:]
+	for {
+		i = strings.IndexByte(path, '/')
+		if i == -1 {
+			return append(dst, path)
+		}
+		dst = append(dst, path[:i])
+		path = path[i+1:]
+	}
+}
+
+// match 會以請求網址比對路由，並在有相符的路由時呼叫該路由。
+// 比對時的暫存變數會在呼叫處理函式之前就放回 `paramsPool`，處理函式所收到的則是一份不會被重複使用的複本。
+func (r *Router) match(routes *routes, w http.ResponseWriter, req *http.Request) bool {
+	url, raw := r.path(req)
+	buf := acquireParams()
+	route := r.find(routes, url, raw, &buf.params, &buf.converted)
+	if route == nil {
+		buf.release()
+		return false
+	}
+	if len(buf.params) == 0 {
+		buf.release()
+		r.call(route, w, req)
+		return true
+	}
+	params := newRequestParams(req.Context(), route, buf)
+	buf.release()
+	r.call(route, w, req.WithContext(params))
+	return true
+}
+
+// allowed 會回傳除了請求方法以外，其他能夠和請求網址相符的方法，以及其中一個相符的路由。
+func (r *Router) allowed(t *routeTable, req *http.Request) ([]string, *Route) {
+	var methods []string
+	var first *Route
+	var firstMethod string
+	var hasGet, hasHead, hasOptions bool
+	url, raw := r.path(req)
+	for method, routes := range t.methods {
+		if method == req.Method {
+			continue
+		}
+		if route := r.find(routes, url, raw, nil, nil); route != nil {
+			methods = append(methods, method)
+			hasGet = hasGet || method == "GET"
+			hasHead = hasHead || method == "HEAD"
+			hasOptions = hasOptions || method == "OPTIONS"
+			if first == nil || method < firstMethod {
+				first = route
+				firstMethod = method
+			}
 		}
 	}
-	return false
+	// 自動回應 HEAD 請求時，有 GET 路由也就代表能以 HEAD 存取。
+	if r.AutoHead && hasGet && !hasHead {
+		methods = append(methods, "HEAD")
+	}
+	// 自動回應 OPTIONS 請求時，任何存在的路徑都能以 OPTIONS 存取。
+	if r.AutoOptions && len(methods) != 0 && !hasOptions && req.Method != "OPTIONS" {
+		methods = append(methods, "OPTIONS")
+	}
+	sort.Strings(methods)
+	return methods, first
+}
+
+// callOptions 會自動回應 OPTIONS 請求，並在回應前執行全域與相符路由所屬群組的中介軟體。
+func (r *Router) callOptions(allowed []string, route *Route, w http.ResponseWriter, req *http.Request) {
+	methods := append([]string{"OPTIONS"}, allowed...)
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	route.routeGroup.optionsChain.ServeHTTP(w, req)
 }
 
 // disaptch 會解析接收到的請求並依照網址分發給指定的路由。
+// 整個請求都會使用同一份路由表，因此執行期間的路由更動不會讓單個請求看見不一致的路由。
 func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) {
+	t := r.current()
+	if req = r.clean(t, w, req); req == nil {
+		return
+	}
+	var allowed []string
+	var other *Route
+	// OPTIONS 請求會事先取得該路徑所允許的方法，讓 `CORS` 中介軟體能夠藉此產生 `Access-Control-Allow-Methods`。
+	if req.Method == "OPTIONS" {
+		allowed, other = r.allowed(t, req)
+		req = contextSet(req, allowKey, allowed)
+	}
 	var matched bool
-	if v, ok := r.methodRoutes[req.Method]; ok {
+	if v, ok := t.methods[req.Method]; ok {
 		matched = r.match(v, w, req)
 	}
-	if !matched {
-		r.callNoRoute(w, req)
+	if matched {
+		return
+	}
+	// 明確定義的 HEAD 路由優先，沒有的話才以 GET 路由回應。
+	if req.Method == "HEAD" && r.AutoHead {
+		if v, ok := t.methods["GET"]; ok {
+			hw := &headResponseWriter{ResponseWriter: w}
+			if r.match(v, hw, req) {
+				hw.finish()
+				return
+			}
+		}
+	}
+	if r.redirect(t, w, req) {
+		return
+	}
+	if req.Method == "OPTIONS" {
+		if r.AutoOptions && len(allowed) != 0 {
+			r.callOptions(allowed, other, w, req)
+			return
+		}
+	} else {
+		allowed, _ = r.allowed(t, req)
 	}
+	if len(allowed) != 0 {
+		r.callNoMethod(allowed, w, req)
+		return
+	}
+	r.callNoRoute(w, req)
+}
+
+// lookup 會以網址片段搜尋相符的動態路由，並回傳該路由，擷取到的變數則會被寫入 `params` 之中。
+// 比對時使用的是小寫的 `components`，而擷取到的變數則是取自保留原始大小寫的 `originals`。
+// 如果路由樹尚未編譯（例如尚未啟動路由器）則會退回逐一掃描所有動態路由。
+func (r *routes) lookup(components []string, originals []string, params *RouteParams, values *[]conversion) *Route {
+	if r.tree != nil {
+		return r.tree.lookup(components, originals, params, values)
+	}
+	return r.scan(components, originals, params, values)
+}
+
+// scan 會依照優先度逐一比對所有動態路由，並回傳第一個相符的路由，擷取到的變數則會被寫入 `params` 之中。
+func (r *routes) scan(components []string, originals []string, params *RouteParams, values *[]conversion) *Route {
+	if len(components) == 0 {
+		return nil
+	}
+	for _, route := range r.dynamics {
+		if route.match(components, originals, params, values) {
+			return route
+		}
+	}
+	*params = (*params)[:0]
+	if values != nil {
+		*values = (*values)[:0]
+	}
+	return nil
 }
 
-// sort 會依照路由群組內路由的片段數來做重新排序，用以改進比對時的優先順序。
-func (r *Router) sort(method string) {
-	sort.Slice(r.methodRoutes[method].dynamics, func(i, j int) bool {
-		return r.methodRoutes[method].dynamics[i].priority > r.methodRoutes[method].dynamics[j].priority
+// sortByPriority 會依照優先度由高至低排列路由，優先度相同的路由會保持定義時的順序。
+func sortByPriority(routes []*Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].priority > routes[j].priority
 	})
 }
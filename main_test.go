@@ -1,12 +1,22 @@
 package davai
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	texttemplate "text/template"
 	"time"
 
 	"context"
@@ -23,6 +33,8 @@ const (
 	methodOptions = "OPTIONS"
 	methodPut     = "PUT"
 	methodPatch   = "PATCH"
+	methodHead    = "HEAD"
+	methodTrace   = "TRACE"
 )
 
 type testRequest struct {
@@ -57,6 +69,8 @@ func sendTestRequests(a *assert.Assertions, reqs []testRequest) {
 			resp, body, errs = request.Put(r.Path).End()
 		case methodPatch:
 			resp, body, errs = request.Patch(r.Path).End()
+		default:
+			resp, body, errs = request.CustomMethod(r.Method, r.Path).End()
 		}
 		a.Len(errs, 0)
 		a.Equal(r.Body, body)
@@ -295,6 +309,12 @@ func TestBasicMethodRoute(t *testing.T) {
 		{
 			Path:       "http://localhost:8080/post",
 			Method:     methodGet,
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "405 method not allowed\n",
+		},
+		{
+			Path:       "http://localhost:8080/nothing",
+			Method:     methodGet,
 			StatusCode: http.StatusNotFound,
 			Body:       "404 page not found\n",
 		},
@@ -1231,12 +1251,10 @@ func TestGenerateRoute(t *testing.T) {
 			"three": "1",
 		})
 	})
-	assert.Panics(func() {
-		r.Generate("Five", map[string]string{
-			"three": "1",
-			"four":  "2",
-		})
-	})
+	assert.Equal("/one/two/1/2", r.Generate("Five", map[string]string{
+		"three": "1",
+		"four":  "2",
+	}))
 	assert.Equal("/one/two/1/2/3", r.Generate("Five", map[string]string{
 		"three": "1",
 		"four":  "2",
@@ -1795,3 +1813,2242 @@ func TestTrailingSlashesRoute(t *testing.T) {
 	r.Shutdown(context.Background())
 	<-time.After(time.Millisecond * 200)
 }
+
+func TestTreeMatchesScan(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r.Rule("e", "(?:.html)")
+	r.Rule("u", "(?:.html)?")
+	for _, path := range []string{
+		"/{one?}",
+		"/{one}/{two?}",
+		"/{one}/{two}/{three?}",
+		"/{i:one}",
+		"/{s:one}/{i:two?}",
+		"/{*:one}",
+		"/two/{*:three}",
+		"/{one}/two/{*:three}",
+		"/{one}/two/three/four/{*:five?}",
+		"/{one}.sub",
+		"/pre.{one}.suf",
+		"/pre.{one?}.suf/pre.{two?}.suf",
+		"/pre.{one}.suf/pre.{two}.suf/pre.{three}.suf/pre.{four?}.suf",
+		"/pre.{i:one}.suf/{s:two}",
+		"/detail{e:one}",
+		"/user{u:one}",
+		"/user/{name}",
+		"/user/{name}/profile",
+		"/user/{i:id}/{*:rest}",
+		"/v1/post/{title?}",
+		"/a/{b?}/c",
+		"/opt/{one}/two?",
+		"/opt/{one}/{two}/three?/{four?}",
+		"/x/{id}/edit/{y}",
+		"/x/{id}/edit?",
+	} {
+		r.Get(path, handler)
+	}
+	r.Get("/{a}", handler).AddPriority(100)
+	r.sortMiddlewares()
+	r.sortRoutes()
+
+	segments := []string{"", "one", "Two", "TWO", "three", "four", "1", "5", "pre.1.suf", "pre..suf", "1.sub", ".sub", "detail.html", "user", "user.html", "user.htm", "profile", "v1", "post", "a", "c", "opt", "x", "edit"}
+	routes := r.current().methods["GET"]
+	var paths [][]string
+	for _, a := range segments {
+		paths = append(paths, []string{a})
+		for _, b := range segments {
+			paths = append(paths, []string{a, b})
+			for _, c := range segments {
+				paths = append(paths, []string{a, b, c})
+			}
+		}
+	}
+	paths = append(paths, strings.Split("one/two/three/four/5/6", "/"), strings.Split("pre.1.suf/pre.2.suf/pre.3.suf/pre.4.suf", "/"))
+	for _, originals := range paths {
+		components := strings.Split(strings.ToLower(strings.Join(originals, "/")), "/")
+		var scanParams, treeParams RouteParams
+		var scanValues, treeValues []conversion
+		scanRoute := routes.scan(components, originals, &scanParams, &scanValues)
+		treeRoute := routes.tree.lookup(components, originals, &treeParams, &treeValues)
+		assert.Equal(scanRoute, treeRoute, strings.Join(originals, "/"))
+		assert.Equal(scanParams, treeParams, strings.Join(originals, "/"))
+		if scanRoute != nil {
+			assert.Equal(scanRoute.convert(scanParams, nil), scanRoute.convert(scanParams, scanValues), strings.Join(originals, "/"))
+			assert.Equal(scanRoute.convert(scanParams, nil), treeRoute.convert(treeParams, treeValues), strings.Join(originals, "/"))
+		}
+	}
+}
+
+// newBenchmarkRouter 會建立一個帶有數百個動態路由的路由器供效能測試使用。
+func newBenchmarkRouter() *Router {
+	r := New()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	for _, resource := range []string{"user", "post", "album", "photo", "comment", "tag", "group", "event", "page", "file"} {
+		for i := 0; i < 10; i++ {
+			prefix := "/api/v" + strconv.Itoa(i) + "/" + resource
+			r.Get(prefix+"/{i:id}", handler)
+			r.Get(prefix+"/{i:id}/{s:field}", handler)
+			r.Get(prefix+"/{i:id}/detail-{name}.json", handler)
+			r.Get(prefix+"/{s:slug?}", handler)
+		}
+	}
+	r.Get("/{*:path}", handler)
+	r.sortMiddlewares()
+	r.sortRoutes()
+	return r
+}
+
+func BenchmarkMatchScan(b *testing.B) {
+	routes := newBenchmarkRouter().current().methods["GET"]
+	components := strings.Split("api/v9/file/profile", "/")
+	var params RouteParams
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		routes.scan(components, components, &params, nil)
+	}
+}
+
+func BenchmarkMatchTree(b *testing.B) {
+	routes := newBenchmarkRouter().current().methods["GET"]
+	components := strings.Split("api/v9/file/profile", "/")
+	var params RouteParams
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		routes.tree.lookup(components, components, &params, nil)
+	}
+}
+
+func TestRegexCache(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Get("/user/{i:id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("cached:" + varsToString(Vars(r))))
+	}).RegexCache = true
+	r.Get("/post/{s:title}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("post:" + varsToString(Vars(r))))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/user/123",
+			Body: "cached:123",
+		},
+		{
+			Path: "http://localhost:8080/user/123",
+			Body: "cached:123",
+		},
+		{
+			Path: "http://localhost:8080/user/456",
+			Body: "cached:456",
+		},
+		{
+			Path: "http://localhost:8080/post/hello",
+			Body: "post:hello",
+		},
+		{
+			Path: "http://localhost:8080/post/hello",
+			Body: "post:hello",
+		},
+		{
+			Path:       "http://localhost:8080/user/abc",
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+	})
+	stats := r.CacheStats()
+	assert.Equal(uint64(1), stats.Hits)
+	assert.Equal(uint64(5), stats.Misses)
+	assert.Equal(2, stats.Size)
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+	c := newCache(2)
+	route := &Route{}
+	var params RouteParams
+	c.set("/a", route, RouteParams{{"v", "a"}})
+	c.set("/b", route, RouteParams{{"v", "b"}})
+	_, ok := c.get("/a", &params)
+	assert.True(ok)
+	assert.Equal("a", params.Get("v"))
+	params.set("v", "changed")
+	c.set("/c", route, RouteParams{{"v", "c"}})
+	_, ok = c.get("/b", &params)
+	assert.False(ok)
+	_, ok = c.get("/a", &params)
+	assert.True(ok)
+	assert.Equal("a", params.Get("v"))
+	c.set("/"+strings.Repeat("x", maxCachePathLength), route, nil)
+	assert.Equal(2, c.stats().Size)
+	c.purge()
+	assert.Equal(0, c.stats().Size)
+}
+
+func TestNoMethod(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+	r.Get("/user/{id}", handler)
+	r.Put("/user/{i:id}", handler)
+	r.Delete("/user/{i:id}", handler)
+	r.Post("/login", handler)
+	r.NoMethod(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-No-Method", "true")
+			next.ServeHTTP(w, r)
+		})
+	}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Allow: " + w.Header().Get("Allow")))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path:       "http://localhost:8080/user/123",
+			Method:     methodPost,
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "Allow: DELETE, GET, PUT",
+		},
+		{
+			Path:       "http://localhost:8080/user/abc",
+			Method:     methodPost,
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "Allow: GET",
+		},
+		{
+			Path:       "http://localhost:8080/login",
+			Method:     methodGet,
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "Allow: POST",
+		},
+		{
+			Path:       "http://localhost:8080/logout",
+			Method:     methodGet,
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+	})
+	resp, _, errs := gorequest.New().Get("http://localhost:8080/login").End()
+	assert.Len(errs, 0)
+	assert.Equal("POST", resp.Header.Get("Allow"))
+	assert.Equal("true", resp.Header.Get("X-No-Method"))
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestCustomMethodRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Head("/head", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Head", "true")
+	})
+	r.Trace("/trace", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Trace"))
+	})
+	r.Handle("PROPFIND", "/dav/{*:path}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("PROPFIND:" + varsToString(Vars(r))))
+	})
+	r.Any("/any", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Any:" + r.Method))
+	})
+	r.Match([]string{methodGet, methodPost}, "/match", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Match:" + r.Method))
+	})
+	v1 := r.Group("/v1")
+	{
+		v1.Handle("MKCOL", "/{name}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("MKCOL:" + varsToString(Vars(r))))
+		})
+		v1.Match([]string{methodPut, methodPatch}, "/match", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Match:" + r.Method))
+		})
+	}
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path:   "http://localhost:8080/head",
+			Method: methodHead,
+			Body:   "",
+		},
+		{
+			Path:   "http://localhost:8080/trace",
+			Method: methodTrace,
+			Body:   "Trace",
+		},
+		{
+			Path:   "http://localhost:8080/dav/a/b",
+			Method: "PROPFIND",
+			Body:   "PROPFIND:a/b",
+		},
+		{
+			Path:   "http://localhost:8080/any",
+			Method: methodDelete,
+			Body:   "Any:DELETE",
+		},
+		{
+			Path:   "http://localhost:8080/any",
+			Method: methodTrace,
+			Body:   "Any:TRACE",
+		},
+		{
+			Path:   "http://localhost:8080/match",
+			Method: methodPost,
+			Body:   "Match:POST",
+		},
+		{
+			Path:       "http://localhost:8080/match",
+			Method:     methodPut,
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "405 method not allowed\n",
+		},
+		{
+			Path:   "http://localhost:8080/v1/folder",
+			Method: "MKCOL",
+			Body:   "MKCOL:folder",
+		},
+		{
+			Path:   "http://localhost:8080/v1/match",
+			Method: methodPatch,
+			Body:   "Match:PATCH",
+		},
+		{
+			Path:       "http://localhost:8080/dav/a/b",
+			Method:     "MKCOL",
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "405 method not allowed\n",
+		},
+	})
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestAutoHead(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.AutoHead = true
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+	r.Get("/user/{id}", middleware, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User:" + varsToString(Vars(r))))
+	})
+	r.Get("/explicit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Get"))
+	})
+	r.Head("/explicit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Head", "true")
+	})
+	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path:   "http://localhost:8080/user/admin",
+			Method: methodHead,
+			Body:   "",
+		},
+		{
+			Path: "http://localhost:8080/user/admin",
+			Body: "User:admin",
+		},
+		{
+			Path:       "http://localhost:8080/login",
+			Method:     methodHead,
+			StatusCode: http.StatusMethodNotAllowed,
+			Body:       "",
+		},
+		{
+			Path:       "http://localhost:8080/nothing",
+			Method:     methodHead,
+			StatusCode: http.StatusNotFound,
+			Body:       "",
+		},
+	})
+	resp, _, errs := gorequest.New().Head("http://localhost:8080/user/admin").End()
+	assert.Len(errs, 0)
+	assert.Equal("true", resp.Header.Get("X-Middleware"))
+	assert.Equal(int64(len("User:admin")), resp.ContentLength)
+
+	resp, _, errs = gorequest.New().Head("http://localhost:8080/explicit").End()
+	assert.Len(errs, 0)
+	assert.Equal("true", resp.Header.Get("X-Head"))
+
+	resp, _, errs = gorequest.New().Delete("http://localhost:8080/user/admin").End()
+	assert.Len(errs, 0)
+	assert.Equal("GET, HEAD", resp.Header.Get("Allow"))
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestAutoOptions(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.AutoOptions = true
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+	r.Get("/user/{id}", handler)
+	r.Post("/user/{id}", handler)
+	r.Options("/explicit", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Explicit"))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path:       "http://localhost:8080/user/123",
+			Method:     methodOptions,
+			StatusCode: http.StatusNoContent,
+			Body:       "",
+		},
+		{
+			Path:   "http://localhost:8080/explicit",
+			Method: methodOptions,
+			Body:   "Explicit",
+		},
+		{
+			Path:       "http://localhost:8080/nothing",
+			Method:     methodOptions,
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+	})
+	resp, _, errs := gorequest.New().Options("http://localhost:8080/user/123").End()
+	assert.Len(errs, 0)
+	assert.Equal("GET, OPTIONS, POST", resp.Header.Get("Allow"))
+	resp, _, errs = gorequest.New().Delete("http://localhost:8080/user/123").End()
+	assert.Len(errs, 0)
+	assert.Equal("GET, OPTIONS, POST", resp.Header.Get("Allow"))
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestCORS(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.AutoOptions = true
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+	r.Get("/public", handler)
+	v1 := r.Group("/v1", CORS(CORSConfig{
+		AllowOrigins:     []string{"https://*.example.com"},
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute * 10,
+	}))
+	{
+		v1.Get("/user/{id}", handler)
+		v1.Put("/user/{id}", handler)
+	}
+	v2 := r.Group("/v2", CORS(CORSConfig{
+		AllowOrigins:        []string{"*"},
+		AllowOriginPatterns: []string{`^https://[a-z]+\.test$`},
+		AllowMethods:        []string{"GET"},
+	}))
+	{
+		v2.Get("/post", handler)
+		v2.Delete("/post", handler)
+	}
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+
+	resp, _, errs := gorequest.New().Options("http://localhost:8080/v1/user/1").
+		Set("Origin", "https://api.example.com").
+		Set("Access-Control-Request-Method", "PUT").
+		End()
+	assert.Len(errs, 0)
+	assert.Equal(http.StatusNoContent, resp.StatusCode)
+	assert.Equal("https://api.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal("GET, PUT", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal("Content-Type, Authorization", resp.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal("true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal("600", resp.Header.Get("Access-Control-Max-Age"))
+
+	resp, body, errs := gorequest.New().Get("http://localhost:8080/v1/user/1").
+		Set("Origin", "https://api.example.com").
+		End()
+	assert.Len(errs, 0)
+	assert.Equal("OK", body)
+	assert.Equal("https://api.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal("X-Total", resp.Header.Get("Access-Control-Expose-Headers"))
+
+	resp, _, errs = gorequest.New().Options("http://localhost:8080/v1/user/1").
+		Set("Origin", "https://evil.com").
+		Set("Access-Control-Request-Method", "PUT").
+		End()
+	assert.Len(errs, 0)
+	assert.Equal("", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	resp, _, errs = gorequest.New().Options("http://localhost:8080/v2/post").
+		Set("Origin", "https://anything.com").
+		Set("Access-Control-Request-Method", "GET").
+		Set("Access-Control-Request-Headers", "X-Custom").
+		End()
+	assert.Len(errs, 0)
+	assert.Equal("*", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal("GET", resp.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal("X-Custom", resp.Header.Get("Access-Control-Allow-Headers"))
+
+	resp, _, errs = gorequest.New().Options("http://localhost:8080/public").
+		Set("Origin", "https://api.example.com").
+		Set("Access-Control-Request-Method", "GET").
+		End()
+	assert.Len(errs, 0)
+	assert.Equal("", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal("GET, OPTIONS", resp.Header.Get("Allow"))
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestCORSOriginWildcard(t *testing.T) {
+	assert := assert.New(t)
+	handler := CORS(CORSConfig{
+		AllowOrigins: []string{"https://*.example.com", "http://localhost:*"},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for origin, allowed := range map[string]bool{
+		"https://api.example.com":          true,
+		"https://API-2.example.com":        true,
+		"http://localhost:3000":            true,
+		"https://.example.com":             false,
+		"https://a.b.example.com":          false,
+		"https://evil.com?x=.example.com":  false,
+		"https://evil.com/.example.com":    false,
+		"https://evil.com#.example.com":    false,
+		"https://api.example.com.evil.com": false,
+		"http://localhost:3000.evil.com":   false,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if allowed {
+			assert.Equal(origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		} else {
+			assert.Equal("", w.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+	}
+}
+
+func TestCaseSensitiveVarsRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Get("/file/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(varsToString(Vars(r))))
+	})
+	r.Get("/Token/pre-{s:token}.JSON", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(varsToString(Vars(r))))
+	})
+	r.Get("/s3/{bucket}/{*:key}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(varsToString(Vars(r))))
+	})
+	r.Get("/cached/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(varsToString(Vars(r))))
+	}).RegexCache = true
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/file/AbCdEf",
+			Body: "AbCdEf",
+		},
+		{
+			Path: "http://localhost:8080/FILE/AbCdEf/",
+			Body: "AbCdEf",
+		},
+		{
+			Path: "http://localhost:8080/token/PRE-aBc123.json",
+			Body: "aBc123",
+		},
+		{
+			Path: "http://localhost:8080/s3/MyBucket/Some/Deep/Key.PNG",
+			Body: "MyBucket,Some/Deep/Key.PNG",
+		},
+		// 轉換成小寫後長度會改變的字元（克氏度符號）也必須保留原本的大小寫。
+		{
+			Path: "http://localhost:8080/file/AbC-%E2%84%AA",
+			Body: "AbC-\u212a",
+		},
+		{
+			Path: "http://localhost:8080/FILE/%C3%89t%C3%A9",
+			Body: "Été",
+		},
+		{
+			Path: "http://localhost:8080/s3/\u212aelvin/%E2%84%A6/Key.PNG",
+			Body: "\u212aelvin,\u2126/Key.PNG",
+		},
+		{
+			Path: "http://localhost:8080/cached/AbC",
+			Body: "AbC",
+		},
+		{
+			Path: "http://localhost:8080/cached/abc",
+			Body: "abc",
+		},
+		{
+			Path: "http://localhost:8080/cached/AbC",
+			Body: "AbC",
+		},
+	})
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+// noRedirectClient 是不會自動跟隨重新導向的 HTTP 客戶端，用來測試重新導向的狀態碼與目的地。
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func TestCaseSensitiveRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		CaseSensitive: true,
+	})
+	r.Get("/Users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Users"))
+	})
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("users"))
+	})
+	r.Get("/Post/pre-{id}.JSON", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(varsToString(Vars(r))))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/Users",
+			Body: "Users",
+		},
+		{
+			Path: "http://localhost:8080/users",
+			Body: "users",
+		},
+		{
+			Path: "http://localhost:8080/Post/pre-AbC.JSON",
+			Body: "AbC",
+		},
+		{
+			Path:       "http://localhost:8080/USERS",
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+		{
+			Path:       "http://localhost:8080/post/pre-AbC.json",
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+	})
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestTrailingSlashStrictRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		TrailingSlash: TrailingSlashStrict,
+	})
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Root"))
+	})
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("users"))
+	})
+	r.Get("/users/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("users/"))
+	})
+	r.Get("/user/{name}/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user/:" + varsToString(Vars(r))))
+	}).Name("User")
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/",
+			Body: "Root",
+		},
+		{
+			Path: "http://localhost:8080/users",
+			Body: "users",
+		},
+		{
+			Path: "http://localhost:8080/users/",
+			Body: "users/",
+		},
+		{
+			Path: "http://localhost:8080/user/admin/",
+			Body: "user/:admin",
+		},
+		{
+			Path:       "http://localhost:8080/user/admin",
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+	})
+	assert.Equal("/user/admin/", r.Generate("User", map[string]string{
+		"name": "admin",
+	}))
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestTrailingSlashRedirectRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		TrailingSlash:  TrailingSlashRedirect,
+		RedirectStatus: http.StatusPermanentRedirect,
+	})
+	r.Get("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("users"))
+	})
+	r.Get("/user/{name}/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user/:" + varsToString(Vars(r))))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/users",
+			Body: "users",
+		},
+		{
+			Path: "http://localhost:8080/users/",
+			Body: "users",
+		},
+		{
+			Path: "http://localhost:8080/user/admin",
+			Body: "user/:admin",
+		},
+	})
+	resp, err := noRedirectClient.Get("http://localhost:8080/users/?page=2")
+	assert.NoError(err)
+	assert.Equal(http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal("/users?page=2", resp.Header.Get("Location"))
+	resp, err = noRedirectClient.Get("http://localhost:8080/user/Admin")
+	assert.NoError(err)
+	assert.Equal(http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal("/user/Admin/", resp.Header.Get("Location"))
+	resp, err = noRedirectClient.Get("http://localhost:8080/nothing/")
+	assert.NoError(err)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestRedirectOpenRedirect(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		TrailingSlash: TrailingSlashRedirect,
+	})
+	r.Get("/{a?}/{b}/", func(w http.ResponseWriter, r *http.Request) {})
+	// 以多個斜線開頭的重新導向網址會被瀏覽器視為指向其他主機，因此必須合併成單個斜線。
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "//evil.com?q=1", nil))
+	assert.Equal(http.StatusMovedPermanently, w.Code)
+	assert.Equal("/evil.com/?q=1", w.Header().Get("Location"))
+}
+
+func TestCleanPathRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		CleanPath: CleanPathServe,
+	})
+	r.Get("/user/admin/profile", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Profile:" + r.URL.Path))
+	})
+	r.Get("/post/{title}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Post:" + varsToString(Vars(r))))
+	})
+	r.Get("/a/{x?}/b", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("A:" + r.URL.Path))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	for path, body := range map[string]string{
+		"//user///admin/./x/../profile": "Profile:/user/admin/profile",
+		"/user/admin/profile":           "Profile:/user/admin/profile",
+		"/post/../post//hello":          "Post:hello",
+		// 整理後的網址沒有相符的路由時，應該以原本的網址比對。
+		"/a//b": "A:/a//b",
+	} {
+		resp, err := noRedirectClient.Get("http://localhost:8080" + path)
+		assert.NoError(err)
+		assert.Equal(http.StatusOK, resp.StatusCode, path)
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(err)
+		resp.Body.Close()
+		assert.Equal(body, string(b), path)
+	}
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+
+	r = New(Config{
+		CleanPath:      CleanPathRedirect,
+		RedirectStatus: http.StatusPermanentRedirect,
+	})
+	r.Get("/user/admin/profile", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Profile"))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	resp, err := noRedirectClient.Get("http://localhost:8080//user///admin/./x/../profile?tab=1")
+	assert.NoError(err)
+	assert.Equal(http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal("/user/admin/profile?tab=1", resp.Header.Get("Location"))
+	resp, err = noRedirectClient.Get("http://localhost:8080//nothing/../else")
+	assert.NoError(err)
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080//user///admin/./x/../profile",
+			Body: "Profile",
+		},
+	})
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestRawPathRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		UseRawPath: true,
+	})
+	r.Get("/file/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("File:" + varsToString(Vars(r))))
+	}).Name("File")
+	r.Get("/file/{id}/meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Meta:" + varsToString(Vars(r))))
+	})
+	r.Get("/src/{*:path}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Src:" + varsToString(Vars(r))))
+	}).Name("Src")
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/file/a%2Fb",
+			Body: "File:a/b",
+		},
+		{
+			Path: "http://localhost:8080/file/a%2Fb/meta",
+			Body: "Meta:a/b",
+		},
+		{
+			Path: "http://localhost:8080/file/hello%20world",
+			Body: "File:hello world",
+		},
+		{
+			Path: "http://localhost:8080/src/dir/a%2Fb.txt",
+			Body: "Src:dir/a/b.txt",
+		},
+		{
+			Path:       "http://localhost:8080/file/a/b",
+			StatusCode: http.StatusNotFound,
+			Body:       "404 page not found\n",
+		},
+	})
+	assert.Equal("/file/a%2Fb", r.Generate("File", map[string]string{
+		"id": "a/b",
+	}))
+	assert.Equal("/file/hello%20world", r.Generate("File", map[string]string{
+		"id": "hello world",
+	}))
+	assert.Equal("/src/dir/a%3Fb.txt", r.Generate("Src", map[string]string{
+		"path": "dir/a?b.txt",
+	}))
+	r.Shutdown(context.Background())
+	<-time.After(time.Millisecond * 200)
+}
+
+func TestRawPathStaticRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{
+		UseRawPath: true,
+	})
+	r.Get("/café", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Café"))
+	})
+	r.Get("/café/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Café:" + varsToString(Vars(r))))
+	}).Name("Café")
+	r.Get("/hello world", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+	})
+	r.Get("/tag/#{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Tag:" + varsToString(Vars(r))))
+	})
+	// 不論網址以大寫、小寫或是尚未編碼的方式表示，都應該能夠比對到經過編碼的靜態片段。
+	for path, body := range map[string]string{
+		"/caf%C3%A9":       "Café",
+		"/caf%c3%a9":       "Café",
+		"/CAF%C3%A9":       "Café",
+		"/caf%C3%A9/a%2Fb": "Café:a/b",
+		"/hello%20world":   "Hello",
+		"/tag/%23go":       "Tag:go",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusOK, w.Code, path)
+		assert.Equal(body, w.Body.String(), path)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL.Path, req.URL.RawPath = "/café/1", ""
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal("Café:1", w.Body.String())
+	assert.Equal("/caf%c3%a9/1", r.Generate("Café", map[string]string{
+		"id": "1",
+	}))
+}
+
+func TestURLRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Get("/one", func(w http.ResponseWriter, r *http.Request) {}).Name("One")
+	r.Get("/one/{two}/{three}", func(w http.ResponseWriter, r *http.Request) {}).Name("Three")
+
+	path, err := r.URL("One")
+	assert.NoError(err)
+	assert.Equal("/one", path)
+
+	path, err = r.URL("Three", map[string]string{
+		"two":   "2",
+		"three": "3",
+	})
+	assert.NoError(err)
+	assert.Equal("/one/2/3", path)
+
+	_, err = r.URL("Typo")
+	assert.True(errors.Is(err, ErrRouteNotFound))
+	assert.Contains(err.Error(), `"Typo"`)
+
+	_, err = r.URL("Three", map[string]string{
+		"two": "2",
+	})
+	assert.True(errors.Is(err, ErrVarNotFound))
+	assert.Contains(err.Error(), `"Three"`)
+	assert.Contains(err.Error(), `"three"`)
+
+	assert.PanicsWithError(fmt.Errorf("%w: %q", ErrRouteNotFound, "Typo").Error(), func() {
+		r.Generate("Typo")
+	})
+}
+
+func TestGenerateRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r.Rule("e", "(?:.html)")
+	r.Rule("u", "(?:.html)?")
+	for _, path := range []string{
+		"/api/resource-{id}.json",
+		"/{one?}",
+		"/user/{name?}",
+		"/{one}/{two?}",
+		"/{i:one}",
+		"/{s:one}/{i:two?}",
+		"/src/{*:file}",
+		"/{one}/two/{*:three}",
+		"/{one}.sub",
+		"/pre.{one?}.suf",
+		"/pre.{one?}.suf/pre.{two?}.suf",
+		"/pre.{i:one}.suf/{s:two}",
+		"/detail{e:one}",
+		"/user{u:one}",
+		"/a/{b?}/c",
+	} {
+		r.Get(path, handler).Name(path)
+	}
+	r.sortMiddlewares()
+	r.sortRoutes()
+
+	values := []string{"", "abc", "123", "A-b", "a b", "x/y", ".html", ".", ".."}
+	for name, route := range r.current().names {
+		var names []string
+		for k := range route.defaultCaptureVars {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		// 以所有可能的變數組合產生路由，成功產生的路徑都必須能再次和同個路由相符，且擷取到相同的變數。
+		combinations := []map[string]string{{}}
+		for _, k := range names {
+			var next []map[string]string
+			for _, c := range combinations {
+				for _, v := range append(values, "\x00omit") {
+					vars := make(map[string]string)
+					for ck, cv := range c {
+						vars[ck] = cv
+					}
+					if v != "\x00omit" {
+						vars[k] = v
+					}
+					next = append(next, vars)
+				}
+			}
+			combinations = next
+		}
+		for _, vars := range combinations {
+			path, err := r.URL(name, vars)
+			if err != nil {
+				assert.True(errors.Is(err, ErrVarNotFound) || errors.Is(err, ErrVarMismatch), err.Error())
+				continue
+			}
+			unescaped, err := url.PathUnescape(path)
+			assert.NoError(err)
+			url, raw := r.canonical(unescaped)
+			var params RouteParams
+			ok := route.match(strings.Split(url, "/")[1:], strings.Split(raw, "/")[1:], &params, nil)
+			if !assert.True(ok, name+" "+path) {
+				continue
+			}
+			for k, v := range route.defaultCaptureVars {
+				if _, ok := vars[k]; !ok {
+					vars[k] = v
+				}
+			}
+			assert.Equal(vars, params.vars(), name+" "+path)
+		}
+	}
+
+	path, err := r.URL("/api/resource-{id}.json", map[string]string{"id": "123"})
+	assert.NoError(err)
+	assert.Equal("/api/resource-123.json", path)
+	path, err = r.URL("/user/{name?}")
+	assert.NoError(err)
+	assert.Equal("/user", path)
+	path, err = r.URL("/pre.{one?}.suf")
+	assert.NoError(err)
+	assert.Equal("/pre..suf", path)
+	_, err = r.URL("/{i:one}", map[string]string{"one": "abc"})
+	assert.True(errors.Is(err, ErrVarMismatch))
+	_, err = r.URL("/api/resource-{id}.json", map[string]string{"id": ""})
+	assert.True(errors.Is(err, ErrVarMismatch))
+	_, err = r.URL("/api/resource-{id}.json", map[string]string{"id": "x/y"})
+	assert.True(errors.Is(err, ErrVarMismatch))
+	path, err = r.URL("/src/{*:file}", map[string]string{"file": "x/y z"})
+	assert.NoError(err)
+	assert.Equal("/src/x/y%20z", path)
+
+	// 瀏覽器會解析 `.` 與 `..` 片段，因此產生的網址不能包含它們。
+	for _, vars := range []map[string]string{{"one": ".."}, {"one": "."}, {"one": "..", "two": "z"}} {
+		_, err = r.URL("/{one}/{two?}", vars)
+		assert.True(errors.Is(err, ErrVarMismatch), vars)
+	}
+	for _, file := range []string{"..", "x/../y", "x/."} {
+		_, err = r.URL("/src/{*:file}", map[string]string{"file": file})
+		assert.True(errors.Is(err, ErrVarMismatch), file)
+	}
+	path, err = r.URL("/src/{*:file}", map[string]string{"file": "x/..y/.z"})
+	assert.NoError(err)
+	assert.Equal("/src/x/..y/.z", path)
+	path, err = r.URL("/pre.{one?}.suf", map[string]string{"one": "."})
+	assert.NoError(err)
+	assert.Equal("/pre...suf", path)
+
+	// 省略位於中間的選擇性變數會留下空白的片段，這在整理網址時仍能和路由相符。
+	path, err = r.URL("/a/{b?}/c")
+	assert.NoError(err)
+	assert.Equal("/a//c", path)
+	for _, mode := range []CleanPath{CleanPathNone, CleanPathServe, CleanPathRedirect} {
+		r := New(Config{CleanPath: mode})
+		r.Get("/a/{b?}/c", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("c:" + Vars(r)["b"]))
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("c:", w.Body.String())
+	}
+}
+
+func TestBuildURLRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Get("/search/{type}", func(w http.ResponseWriter, r *http.Request) {}).Name("Search")
+
+	path, err := r.BuildURL("Search", URLOptions{
+		Vars: map[string]string{"type": "books"},
+		Query: url.Values{
+			"sort": {"asc"},
+			"page": {"2"},
+			"tag":  {"b", "a"},
+		},
+		Fragment: "results",
+	})
+	assert.NoError(err)
+	assert.Equal("/search/books?page=2&sort=asc&tag=b&tag=a#results", path)
+
+	path, err = r.BuildURL("Search", URLOptions{
+		Vars: map[string]string{"type": "books", "page": "2", "q": "a&b"},
+	})
+	assert.NoError(err)
+	assert.Equal("/search/books", path)
+
+	query := url.Values{"tag": {"go"}}
+	path, err = r.BuildURL("Search", URLOptions{
+		Vars:             map[string]string{"type": "books", "page": "2", "q": "a&b"},
+		Query:            query,
+		Fragment:         "top part",
+		ExtraVarsAsQuery: true,
+	})
+	assert.NoError(err)
+	assert.Equal("/search/books?page=2&q=a%26b&tag=go#top%20part", path)
+	assert.Equal(url.Values{"tag": {"go"}}, query)
+
+	_, err = r.BuildURL("Search", URLOptions{})
+	assert.True(errors.Is(err, ErrVarNotFound))
+	_, err = r.BuildURL("Typo", URLOptions{})
+	assert.True(errors.Is(err, ErrRouteNotFound))
+}
+
+func TestAbsoluteURLRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{BaseURL: "https://example.com/app/"})
+	r.Get("/product/{id}", func(w http.ResponseWriter, r *http.Request) {}).Name("Product")
+
+	path, err := r.BuildURL("Product", URLOptions{
+		Vars:     map[string]string{"id": "152"},
+		Query:    url.Values{"ref": {"mail"}},
+		Absolute: true,
+	})
+	assert.NoError(err)
+	assert.Equal("https://example.com/app/product/152?ref=mail", path)
+
+	req := httptest.NewRequest("GET", "http://internal:8080/", nil)
+	path, err = r.BuildURL("Product", URLOptions{
+		Vars:     map[string]string{"id": "152"},
+		Absolute: true,
+		Request:  req,
+	})
+	assert.NoError(err)
+	assert.Equal("http://internal:8080/product/152", path)
+
+	req.Header.Set("X-Forwarded-Proto", "HTTPS")
+	req.Header.Set("X-Forwarded-Host", "shop.example.com, proxy.local")
+	path, err = r.BuildURL("Product", URLOptions{
+		Vars:     map[string]string{"id": "152"},
+		Absolute: true,
+		Request:  req,
+	})
+	assert.NoError(err)
+	assert.Equal("https://shop.example.com/product/152", path)
+
+	r.BaseURL = ""
+	_, err = r.BuildURL("Product", URLOptions{
+		Vars:     map[string]string{"id": "152"},
+		Absolute: true,
+	})
+	assert.True(errors.Is(err, ErrBaseURLNotFound))
+}
+
+func TestFuncMapRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New(Config{BaseURL: "https://example.com"})
+	r.Get("/product/{type}/{id}", func(w http.ResponseWriter, r *http.Request) {}).Name("Product")
+
+	var buf bytes.Buffer
+	tmpl := htmltemplate.Must(htmltemplate.New("").Funcs(r.FuncMap()).Parse(`<a href="{{ url "Product" "type" "large" "id" 152 "page" 2 "tag" "a" "tag" "b" "#" "top" }}">`))
+	assert.NoError(tmpl.Execute(&buf, nil))
+	assert.Equal(`<a href="/product/large/152?page=2&amp;tag=a&amp;tag=b#top">`, buf.String())
+
+	buf.Reset()
+	text := texttemplate.Must(texttemplate.New("").Funcs(r.FuncMap()).Parse(`{{ absURL "Product" "type" "large" "id" "152" }}`))
+	assert.NoError(text.Execute(&buf, nil))
+	assert.Equal("https://example.com/product/large/152", buf.String())
+
+	for _, expr := range []string{
+		`{{ url "Product" "type" "large" }}`,
+		`{{ url "Typo" }}`,
+		`{{ url "Product" "type" }}`,
+		`{{ url "Product" 1 "large" }}`,
+	} {
+		buf.Reset()
+		tmpl := htmltemplate.Must(htmltemplate.New("").Funcs(r.FuncMap()).Parse(expr))
+		assert.Error(tmpl.Execute(&buf, nil), expr)
+	}
+	err := texttemplate.Must(texttemplate.New("").Funcs(r.FuncMap()).Parse(`{{ url "Product" "type" "large" }}`)).Execute(&buf, nil)
+	assert.True(errors.Is(err, ErrVarNotFound))
+}
+
+func TestTypedVarsRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	// badRequest 是統一處理路由變數錯誤的範例。
+	badRequest := func(w http.ResponseWriter, err error) {
+		var e *VarError
+		if errors.As(err, &e) {
+			w.WriteHeader(e.StatusCode())
+			w.Write([]byte(e.Name + ":" + e.Type))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	r.Get("/int/{id?}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := VarInt(r, "id")
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		w.Write([]byte(strconv.Itoa(id * 2)))
+	})
+	r.Get("/int64/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := VarInt64(r, "id")
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		w.Write([]byte(strconv.FormatInt(id+1, 10)))
+	})
+	r.Get("/bool/{flag}", func(w http.ResponseWriter, r *http.Request) {
+		flag, err := VarBool(r, "flag")
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		w.Write([]byte(strconv.FormatBool(!flag)))
+	})
+	r.Get("/time/{date}", func(w http.ResponseWriter, r *http.Request) {
+		date, err := VarTime(r, "date", "2006-01-02")
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		w.Write([]byte(date.Weekday().String()))
+	})
+	r.Get("/uuid/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := VarUUID(r, "id")
+		if err != nil {
+			badRequest(w, err)
+			return
+		}
+		w.Write([]byte(id))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/int/21",
+			Body: "42",
+		},
+		{
+			Path:       "http://localhost:8080/int/abc",
+			Body:       "id:int",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Path:       "http://localhost:8080/int",
+			Body:       "id:int",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Path: "http://localhost:8080/int64/9223372036854775806",
+			Body: "9223372036854775807",
+		},
+		{
+			Path:       "http://localhost:8080/int64/9223372036854775808",
+			Body:       "id:int64",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Path: "http://localhost:8080/bool/true",
+			Body: "false",
+		},
+		{
+			Path:       "http://localhost:8080/bool/yes",
+			Body:       "flag:bool",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Path: "http://localhost:8080/time/2020-02-29",
+			Body: "Saturday",
+		},
+		{
+			Path:       "http://localhost:8080/time/2021-02-29",
+			Body:       "date:time",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Path: "http://localhost:8080/uuid/123E4567-E89B-12D3-A456-426614174000",
+			Body: "123e4567-e89b-12d3-a456-426614174000",
+		},
+		{
+			Path:       "http://localhost:8080/uuid/123e4567e89b12d3a456426614174000",
+			Body:       "id:uuid",
+			StatusCode: http.StatusBadRequest,
+		},
+	})
+	r.Shutdown(context.Background())
+
+	err := &VarError{Name: "id", Value: "abc", Type: "int", Err: strconv.ErrSyntax}
+	assert.True(errors.Is(err, strconv.ErrSyntax))
+	assert.Equal(`davai: the variable "id" with value "abc" is not a valid int: invalid syntax`, err.Error())
+	err = &VarError{Name: "id", Type: "int", Err: ErrVarEmpty}
+	assert.True(errors.Is(err, ErrVarEmpty))
+	assert.Equal(`davai: the variable "id" is required as int`, err.Error())
+}
+
+// testLevel 是用來測試 `encoding.TextUnmarshaler` 綁定的型態。
+type testLevel int
+
+func (l *testLevel) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+// testPaging 是用來測試嵌入建構體綁定的型態。
+type testPaging struct {
+	Page  int  `query:"page"`
+	Limit uint `query:"limit"`
+}
+
+// testInput 是用來測試 `BindVars` 的輸入建構體。
+type testInput struct {
+	testPaging
+	ID      int64         `davai:"id"`
+	Name    string        `davai:"name"`
+	Ratio   float64       `query:"ratio"`
+	Debug   bool          `query:"debug"`
+	Wait    time.Duration `query:"wait"`
+	Level   testLevel     `query:"level"`
+	Since   *time.Time    `query:"since"`
+	Tags    []string      `query:"tag"`
+	Token   string        `header:"X-Token"`
+	Ignored string
+}
+
+func TestBindVarsRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Get("/user/{id}/{name?}", func(w http.ResponseWriter, r *http.Request) {
+		input := testInput{Name: "guest", Ignored: "ignored"}
+		if err := BindVars(r, &input); err != nil {
+			var e *BindError
+			if errors.As(err, &e) {
+				w.WriteHeader(e.StatusCode())
+				for _, v := range e.Errors {
+					w.Write([]byte(v.Name + ";"))
+				}
+			}
+			return
+		}
+		var since string
+		if input.Since != nil {
+			since = input.Since.Format("2006-01-02")
+		}
+		w.Write([]byte(fmt.Sprintf("%d|%s|%d|%d|%g|%t|%s|%d|%s|%s|%s|%s", input.ID, input.Name, input.Page, input.Limit, input.Ratio, input.Debug, input.Wait, input.Level, since, strings.Join(input.Tags, ","), input.Token, input.Ignored)))
+	})
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/user/42",
+			Body: "42|guest|0|0|0|false|0s|0||||ignored",
+		},
+		{
+			Path: "http://localhost:8080/user/42/YamiOdymel?page=2&limit=10&ratio=0.5&debug=true&wait=1m30s&level=high&since=2020-02-29T00:00:00Z&tag=a&tag=b&Ignored=x",
+			Body: "42|YamiOdymel|2|10|0.5|true|1m30s|2|2020-02-29|a,b||ignored",
+		},
+		{
+			Path:       "http://localhost:8080/user/abc?page=x&limit=-1&debug=yes&wait=1&level=medium&since=today",
+			Body:       "page;limit;id;debug;wait;level;since;",
+			StatusCode: http.StatusBadRequest,
+		},
+	})
+	r.Shutdown(context.Background())
+
+	req := httptest.NewRequest("GET", "/?tag=1&tag=x", nil)
+	req.Header.Set("X-Token", "secret")
+	var input struct {
+		Tags  []int  `query:"tag"`
+		Token string `header:"X-Token"`
+	}
+	err := BindVars(req, &input)
+	assert.Equal(`davai: the query parameter "tag" with value "1,x" is not a valid []int: strconv.ParseInt: parsing "x": invalid syntax`, err.Error())
+	var e *VarError
+	assert.True(errors.As(err, &e))
+	assert.Equal(sourceQuery, e.Source)
+	assert.True(errors.Is(err, strconv.ErrSyntax))
+	assert.False(errors.Is(err, ErrVarEmpty))
+	assert.Equal("secret", input.Token)
+
+	var header struct {
+		Token []string `header:"x-token"`
+	}
+	req.Header.Add("X-Token", "again")
+	assert.NoError(BindVars(req, &header))
+	assert.Equal([]string{"secret", "again"}, header.Token)
+
+	assert.True(errors.Is(BindVars(req, input), ErrInvalidBindTarget))
+	assert.True(errors.Is(BindVars(req, nil), ErrInvalidBindTarget))
+}
+
+func TestRuleConverterRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Rule("n", "[0-9]+", func(v string) (interface{}, error) {
+		return strconv.ParseInt(v, 10, 64)
+	})
+	r.RuleFunc("even", func(v string) (interface{}, error) {
+		i, err := strconv.Atoi(v)
+		if err != nil || i%2 != 0 {
+			return nil, errors.New("not an even number")
+		}
+		return i, nil
+	})
+	r.RuleFunc("upper", func(v string) (interface{}, error) {
+		if v != strings.ToUpper(v) {
+			return nil, errors.New("not uppercase")
+		}
+		return v, nil
+	})
+	r.Get("/n/{n:id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("n:%d", Values(r)["id"].(int64)+1)))
+	})
+	r.Get("/n/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("%v:%s", Values(r), Vars(r)["id"])))
+	})
+	r.Get("/even/{even:id}/{even:page?}", func(w http.ResponseWriter, r *http.Request) {
+		values := Values(r)
+		w.Write([]byte(fmt.Sprintf("%d|%v", values["id"].(int), values["page"])))
+	})
+	r.Get("/code/{upper:code}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Values(r)["code"].(string)))
+	})
+	r.Get("/gen/{even:id}", func(w http.ResponseWriter, r *http.Request) {}).Name("Even")
+	go func() {
+		err := r.Run()
+		if err != nil && err != http.ErrServerClosed {
+			assert.NoError(err)
+		}
+	}()
+	<-time.After(time.Millisecond * 200)
+	sendTestRequests(assert, []testRequest{
+		{
+			Path: "http://localhost:8080/n/41",
+			Body: "n:42",
+		},
+		{
+			Path: "http://localhost:8080/n/99999999999999999999",
+			Body: "map[]:99999999999999999999",
+		},
+		{
+			Path: "http://localhost:8080/even/4",
+			Body: "4|<nil>",
+		},
+		{
+			Path: "http://localhost:8080/even/4/6",
+			Body: "4|6",
+		},
+		{
+			Path:       "http://localhost:8080/even/3",
+			Body:       "404 page not found\n",
+			StatusCode: http.StatusNotFound,
+		},
+		{
+			Path:       "http://localhost:8080/even/4/5",
+			Body:       "404 page not found\n",
+			StatusCode: http.StatusNotFound,
+		},
+		{
+			Path: "http://localhost:8080/code/ABC",
+			Body: "ABC",
+		},
+		{
+			Path:       "http://localhost:8080/code/AbC",
+			Body:       "404 page not found\n",
+			StatusCode: http.StatusNotFound,
+		},
+	})
+	r.Shutdown(context.Background())
+
+	_, err := r.URL("Even", map[string]string{"id": "3"})
+	assert.True(errors.Is(err, ErrVarMismatch))
+	path, err := r.URL("Even", map[string]string{"id": "8"})
+	assert.NoError(err)
+	assert.Equal("/gen/8", path)
+
+	// 比對時轉換過的變數應該直接交給 `Values`，而不是再轉換一次。
+	var calls int
+	r = New()
+	r.RuleFunc("count", func(v string) (interface{}, error) {
+		calls++
+		return v, nil
+	})
+	r.Get("/count/{count:v}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("%v,%v", Values(r)["v"], Values(r)["v"])))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/count/a", nil))
+	assert.Equal("a,a", w.Body.String())
+	assert.Equal(1, calls)
+}
+
+func TestBuiltinRules(t *testing.T) {
+	assert := assert.New(t)
+	tests := map[string]struct {
+		match    []string
+		mismatch []string
+	}{
+		"i": {
+			match:    []string{"0", "0042", "9223372036854775807", "12345678901234567890"},
+			mismatch: []string{"-1", "+1", "abc"},
+		},
+		"int": {
+			match:    []string{"0", "42", "-42", "+7", "9223372036854775807", "-9223372036854775808"},
+			mismatch: []string{"abc", "1.5", "9223372036854775808", "-9223372036854775809", "1e3"},
+		},
+		"uint": {
+			match:    []string{"0", "42", "18446744073709551615"},
+			mismatch: []string{"-1", "+1", "18446744073709551616", "abc"},
+		},
+		"uuid": {
+			match:    []string{"123e4567-e89b-12d3-a456-426614174000", "123E4567-E89B-12D3-A456-426614174000"},
+			mismatch: []string{"123e4567e89b12d3a456426614174000", "123e4567-e89b-12d3-a456-42661417400g", "123e4567-e89b-12d3-a456-4266141740000"},
+		},
+		"ulid": {
+			match:    []string{"01ARZ3NDEKTSV4RRFFQ69G5FAV", "01arz3ndektsv4rrffq69g5fav"},
+			mismatch: []string{"81ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAI", "01ARZ3NDEKTSV4RRFFQ69G5FA"},
+		},
+		"slug": {
+			match:    []string{"hello", "hello-world", "post-2020"},
+			mismatch: []string{"-hello", "hello-", "hello--world", "hello_world"},
+		},
+		"hex": {
+			match:    []string{"deadbeef", "DEADBEEF", "0123456789abcdef"},
+			mismatch: []string{"xyz", "0x1f", "dead beef"},
+		},
+		"base64url": {
+			match:    []string{"aGVsbG8", "aGVsbG8=", "a-b_c", "YQ=="},
+			mismatch: []string{"a+b", "a=b", "YQ==="},
+		},
+		"date": {
+			match:    []string{"2020-02-29", "1999-12-31"},
+			mismatch: []string{"2021-02-29", "2020-13-01", "2020-1-1", "20200101"},
+		},
+		"semver": {
+			match:    []string{"1.2.3", "0.0.0", "1.2.3-beta.1", "1.2.3-rc.1+build.5", "10.20.30+meta"},
+			mismatch: []string{"1.2", "01.2.3", "1.2.3-", "v1.2.3", "1.2.3+"},
+		},
+		"alpha": {
+			match:    []string{"abc", "ABC", "aBc"},
+			mismatch: []string{"abc1", "a-b", "ä"},
+		},
+		"lower": {
+			match:    []string{"abc", "hello"},
+			mismatch: []string{"Abc", "ABC", "abc1", "a-b"},
+		},
+		"locale": {
+			match:    []string{"en", "zh-TW", "zh-Hant-TW", "es-419", "yue"},
+			mismatch: []string{"e", "english", "zh_TW", "zh-TWN", "zh-Hant-"},
+		},
+	}
+	r := New()
+	for name := range tests {
+		r.Get("/"+name+"/{"+name+":v}", func(w http.ResponseWriter, r *http.Request) {})
+	}
+	r.sortMiddlewares()
+	r.sortRoutes()
+	for name, test := range tests {
+		for _, v := range test.match {
+			path, raw := r.canonical("/" + name + "/" + v)
+			var params RouteParams
+			route := r.find(r.current().methods["GET"], path, raw, &params, nil)
+			if assert.NotNil(route, name+" "+v) {
+				assert.Equal(v, params.Get("v"), name)
+			}
+		}
+		for _, v := range test.mismatch {
+			path, raw := r.canonical("/" + name + "/" + v)
+			route := r.find(r.current().methods["GET"], path, raw, nil, nil)
+			assert.Nil(route, name+" "+v)
+		}
+	}
+
+	var params RouteParams
+	path, raw := r.canonical("/i/0042")
+	matched := r.find(r.current().methods["GET"], path, raw, &params, nil)
+	assert.Equal(map[string]interface{}{"v": int64(42)}, matched.convert(params, nil))
+	path, raw = r.canonical("/i/12345678901234567890")
+	matched = r.find(r.current().methods["GET"], path, raw, &params, nil)
+	assert.Equal(map[string]interface{}{"v": nil}, matched.convert(params, nil))
+	path, raw = r.canonical("/int/-42")
+	matched = r.find(r.current().methods["GET"], path, raw, &params, nil)
+	assert.Equal(map[string]interface{}{"v": int64(-42)}, matched.convert(params, nil))
+	path, raw = r.canonical("/uint/42")
+	matched = r.find(r.current().methods["GET"], path, raw, &params, nil)
+	assert.Equal(map[string]interface{}{"v": uint64(42)}, matched.convert(params, nil))
+	path, raw = r.canonical("/uuid/123E4567-E89B-12D3-A456-426614174000")
+	matched = r.find(r.current().methods["GET"], path, raw, &params, nil)
+	assert.Equal(map[string]interface{}{"v": [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}}, matched.convert(params, nil))
+	path, raw = r.canonical("/date/2020-02-29")
+	matched = r.find(r.current().methods["GET"], path, raw, &params, nil)
+	assert.Equal(map[string]interface{}{"v": time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)}, matched.convert(params, nil))
+}
+
+func TestValidateRoute(t *testing.T) {
+	assert := assert.New(t)
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	var nilHandler func(http.ResponseWriter, *http.Request)
+
+	r := New()
+	r.Get("/user/{i:id}", handler).Name("User")
+	r.Get("/post/{s:title?}", handler)
+	r.Get("/file/pre-{*:file}.png", handler)
+	r.ServeFiles("/static", "./test")
+	assert.NoError(r.Validate())
+
+	for _, test := range []struct {
+		define func(r *Router)
+		err    error
+		text   string
+	}{
+		{func(r *Router) { r.Get("/user/{unknown:id}", handler) }, ErrRuleNotFound, `route GET /user/{unknown:id} uses "unknown"`},
+		{func(r *Router) { r.Get("/user/{id", handler) }, ErrInvalidPath, `unbalanced braces in "{id"`},
+		{func(r *Router) { r.Get("/user/id}", handler) }, ErrInvalidPath, `unbalanced braces in "id}"`},
+		{func(r *Router) { r.Get("/user/}id{", handler) }, ErrInvalidPath, `unbalanced braces in "}id{"`},
+		{func(r *Router) { r.Get("/user/{a}{b}", handler) }, ErrInvalidPath, `unbalanced braces in "{a}{b}"`},
+		{func(r *Router) { r.Get("/user/{}", handler) }, ErrInvalidPath, `an empty rule or variable name in "{}"`},
+		{func(r *Router) { r.Get("/user/{i:}", handler) }, ErrInvalidPath, `an empty rule or variable name in "{i:}"`},
+		{func(r *Router) { r.Get("/user/{:id}", handler) }, ErrInvalidPath, `an empty rule or variable name in "{:id}"`},
+		{func(r *Router) { r.Get("/user/{i:s:id}", handler) }, ErrInvalidPath, `too many colons in "{i:s:id}"`},
+		{func(r *Router) { r.Get("/user/{id}/{i:id}", handler) }, ErrInvalidPath, `route GET /user/{id}/{i:id} captures "id" more than once`},
+		{func(r *Router) { r.Get("/user") }, ErrHandlerNotFound, `route GET /user`},
+		{func(r *Router) { r.Get("/user", nilHandler) }, ErrHandlerNotFound, `route GET /user`},
+		{func(r *Router) { r.Get("/user", nil, handler) }, ErrHandlerNotFound, `route GET /user`},
+		{func(r *Router) { r.Get("/user", 123) }, ErrHandlerNotFound, `route GET /user`},
+		{func(r *Router) {
+			r.Get("/user", handler).Name("User")
+			r.Post("/user", handler).Name("User")
+		}, ErrDuplicateName, `"User" is already used by GET /user`},
+	} {
+		r := New()
+		test.define(r)
+		err := r.Validate()
+		assert.True(errors.Is(err, test.err), test.text)
+		if assert.Error(err) {
+			assert.Contains(err.Error(), test.text)
+		}
+		// 有錯誤的路由器不應該開始服務。
+		assert.True(errors.Is(r.Run(":0"), test.err), test.text)
+	}
+
+	r = New()
+	r.Get("/user/{unknown:id}/{id}", handler)
+	r.Get("/post/{id}/{id}")
+	err := r.Validate()
+	assert.True(errors.Is(err, ErrRuleNotFound))
+	assert.True(errors.Is(err, ErrInvalidPath))
+	assert.True(errors.Is(err, ErrHandlerNotFound))
+	assert.False(errors.Is(err, ErrRouteConflict))
+	assert.Len(strings.Split(err.Error(), "\n"), 4)
+}
+
+func TestConflicts(t *testing.T) {
+	assert := assert.New(t)
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	r := New()
+	r.Get("/about", handler)
+	r.Get("/about", handler)
+	r.Post("/about", handler)
+	r.Get("/user/{name}", handler)
+	r.Get("/user/{s:id}", handler)
+	r.Get("/user/{id}", handler)
+	r.Get("/user/admin", handler)
+	r.Get("/post/{i:id}", handler)
+	r.Get("/post/{alpha:slug}", handler)
+	r.Get("/post/{i:id}/{tab?}", handler)
+	r.Get("/src/{*:file}", handler)
+	r.Get("/src/{dir}/{file}", handler)
+	r.Get("/img/{name}.png", handler)
+	r.Get("/img/{name}", handler)
+	r.Get("/doc/{name}", handler)
+	r.Get("/doc/{name}.pdf", handler)
+
+	var descriptions []string
+	for _, v := range r.Conflicts() {
+		descriptions = append(descriptions, v.String())
+	}
+	assert.Equal([]string{
+		"GET /about is a duplicate of GET /about",
+		"GET /post/{i:id} is shadowed by GET /post/{i:id}/{tab?}",
+		"GET /user/{name} is ambiguous with GET /user/{s:id}",
+		"GET /user/{id} is a duplicate of GET /user/{name}",
+		"GET /img/{name} is ambiguous with GET /img/{name}.png",
+		"GET /doc/{name} is ambiguous with GET /doc/{name}.pdf",
+		"GET /src/{*:file} is ambiguous with GET /src/{dir}/{file}",
+	}, descriptions)
+
+	// 被隱藏的路由必須真的永遠無法被比對到。
+	r.sortMiddlewares()
+	r.sortRoutes()
+	for _, v := range r.Conflicts() {
+		if v.Kind == ConflictAmbiguous || v.Route.isStatic {
+			continue
+		}
+		for _, value := range []string{"a", "1", "x.png", "admin"} {
+			vars := make(map[string]string)
+			for k := range v.Route.defaultCaptureVars {
+				vars[k] = value
+			}
+			path, err := v.Route.generate(vars)
+			if err != nil {
+				continue
+			}
+			url, raw := r.canonical(path)
+			route := r.find(r.current().methods["GET"], url, raw, nil, nil)
+			assert.NotEqual(v.Route, route, path)
+		}
+	}
+
+	r.StrictRoutes = true
+	err := r.Validate()
+	assert.True(errors.Is(err, ErrRouteConflict))
+	assert.Contains(err.Error(), "GET /post/{i:id} is shadowed by GET /post/{i:id}/{tab?}")
+	assert.True(errors.Is(r.Run(":0"), ErrRouteConflict))
+
+	r = New(Config{StrictRoutes: true})
+	r.Get("/user/{i:id}", handler)
+	r.Get("/user/{alpha:name}", handler)
+	r.Get("/user/admin", handler)
+	r.Get("/{a}/{b}", handler)
+	r.Get("/img/{i:id}.png", handler)
+	r.Get("/img/{alpha:name}", handler)
+	assert.Empty(r.Conflicts())
+	assert.NoError(r.Validate())
+
+	// 不同的規則仍可能接受相同的內容，例如 `i` 的內容全都符合 `s`，自訂規則則無法得知是否相交。
+	r = New(Config{StrictRoutes: true})
+	r.Rule("code", "[0-9a-z]+")
+	r.Get("/user/{s:name}", handler)
+	r.Get("/user/{i:id}", handler)
+	r.Get("/post/{code:code}", handler)
+	r.Get("/post/{i:id}", handler)
+	r.Get("/tag/{i:id}", handler)
+	r.Get("/tag/a{alpha:name}", handler)
+	descriptions = nil
+	for _, v := range r.Conflicts() {
+		assert.Equal(ConflictAmbiguous, v.Kind)
+		descriptions = append(descriptions, v.String())
+	}
+	assert.Len(descriptions, 2)
+	assert.Contains(strings.Join(descriptions, ","), "GET /user/{i:id}")
+	assert.Contains(strings.Join(descriptions, ","), "GET /post/{i:id}")
+	assert.True(errors.Is(r.Validate(), ErrRouteConflict))
+}
+
+func TestBuildRoute(t *testing.T) {
+	assert := assert.New(t)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Global") + "," + Vars(r)["id"]))
+	}
+	r := New()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("X-Global", "global")
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/user/{id}", handler)
+	r.Get("/about", handler)
+
+	// 沒有透過 `Run` 啟動的路由器會在第一個請求時自動編譯，同時抵達的請求也只會編譯一次。
+	server := httptest.NewServer(r)
+	defer server.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Get(server.URL + "/user/" + strconv.Itoa(i))
+			if !assert.NoError(err) {
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal("global,"+strconv.Itoa(i), string(body))
+		}(i)
+	}
+	wg.Wait()
+	assert.NoError(r.Build())
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/about", nil))
+	assert.Equal("global,", w.Body.String())
+
+	for _, register := range []func(){
+		func() { r.Get("/new", handler) },
+		func() { r.Group("/v1") },
+		func() { r.Use(func(next http.Handler) http.Handler { return next }) },
+		func() { r.Rule("n", "[0-9]+") },
+		func() { r.RuleFunc("n", nil) },
+		func() { r.NoRoute(handler) },
+		func() { r.NoMethod(handler) },
+		func() { r.routeGroups[0].Use(func(next http.Handler) http.Handler { return next }) },
+		func() { r.current().routes[0].Name("User") },
+		func() { r.current().routes[0].AddPriority(1) },
+	} {
+		assert.PanicsWithError(ErrRouterFrozen.Error(), register)
+	}
+
+	r = New()
+	r.Get("/user/{unknown:id}", handler)
+	assert.True(errors.Is(r.Build(), ErrRuleNotFound))
+	assert.Panics(func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/1", nil))
+	})
+	// 編譯失敗的路由器並不會被凍結，因此仍能修正路由。
+	r.Rule("unknown", "[0-9]+")
+	assert.NotPanics(func() { r.Get("/post/{id}", handler) })
+
+	// 自動編譯失敗之後的請求應該直接以相同的錯誤發生 panic，而不是每次都重新編譯。
+	r = New()
+	r.Get("/user/{unknown:id}", handler).Name("User")
+	serve := func() { r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/1", nil)) }
+	assert.Panics(serve)
+	r.Get("/post/{id}", handler).Name("User")
+	err := r.Validate()
+	assert.True(errors.Is(err, ErrDuplicateName))
+	assert.PanicsWithError(r.current().routes[0].validate()[0].Error(), serve)
+	assert.True(errors.Is(r.Build(), ErrDuplicateName))
+}
+
+func TestPrecompiledChainRoute(t *testing.T) {
+	assert := assert.New(t)
+	var constructed int
+	// counter 是在建構時會計數的中介軟體，每個路由的中介軟體鏈應該只會在編譯時建構一次。
+	counter := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			constructed++
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	r := New(Config{AutoOptions: true})
+	r.Use(counter("global,"))
+	r.NoRoute(counter("noroute,"), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	v1 := r.Group("/v1", counter("group,"))
+	v1.Get("/user", counter("route,"), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user"))
+	})
+	r.Get("/post", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("post"))
+	})
+	assert.NoError(r.Build())
+	built := constructed
+
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/v1/user", "global,group,route,user"},
+		{"GET", "/post", "global,post"},
+		{"GET", "/nothing", "noroute,"},
+		{"OPTIONS", "/v1/user", "global,group,"},
+	} {
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			assert.Equal(test.body, w.Body.String(), test.path)
+		}
+	}
+	assert.Equal(built, constructed)
+}
+
+// newChainBenchmarkRouter 會建立一個帶有數個中介軟體的路由器供效能測試使用。
+func newChainBenchmarkRouter() (*Router, *Route) {
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+		})
+	}
+	r := New()
+	r.Use(middleware, middleware)
+	route := r.Group("/api", middleware).Get("/about", middleware, middleware, func(w http.ResponseWriter, r *http.Request) {})
+	r.Build()
+	return r, route
+}
+
+// BenchmarkChainPerRequest 以每個請求都重新串連中介軟體的方式呼叫路由，作為預先編譯的比較基準。
+func BenchmarkChainPerRequest(b *testing.B) {
+	_, route := newChainBenchmarkRouter()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/about", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain(route.middlewares, route.handler).ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkChainPrecompiled(b *testing.B) {
+	r, route := newChainBenchmarkRouter()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/about", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.call(route, w, req)
+	}
+}
+
+func TestParamsRoute(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	var kept RouteParams
+	r.Get("/user/{i:id}/{s:tab?}", func(w http.ResponseWriter, r *http.Request) {
+		params := Params(r)
+		var pairs []string
+		for _, p := range params {
+			pairs = append(pairs, p.Key+"="+p.Value)
+		}
+		_, ok := params.Lookup("page")
+		w.Write([]byte(fmt.Sprintf("%s|%s|%s|%d|%v|%s", strings.Join(pairs, ","), params.Get("id"), params.ByIndex(1).Key, params.Len(), ok, varsToString(Vars(r)))))
+		kept = params.Copy()
+	})
+	r.Get("/about", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf("%v|%v|%s", Params(r) == nil, Vars(r) == nil, Params(r).ByIndex(0).Key)))
+	})
+	var escaped []*http.Request
+	r.Get("/later/{name}", func(w http.ResponseWriter, r *http.Request) {
+		escaped = append(escaped, r)
+	})
+	slow := make(chan string, 2)
+	r.Get("/slow/{i:id}", http.TimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-time.After(time.Millisecond * 50)
+		slow <- varsToString(Vars(r))
+	}), time.Millisecond*10, "timeout"))
+
+	for _, test := range []struct {
+		path string
+		body string
+	}{
+		{"/user/12/Posts", "id=12,tab=Posts|12|tab|2|false|12,Posts"},
+		{"/user/34", "id=34,tab=|34|tab|2|false|,34"},
+		{"/about", "true|true|"},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		assert.Equal(test.body, w.Body.String(), test.path)
+	}
+	// 複製後的路由變數不會在之後的請求中被重複使用。
+	assert.Equal(RouteParams{{"id", "34"}, {"tab", ""}}, kept)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/user/56/Likes", nil))
+	assert.Equal(RouteParams{{"id", "56"}, {"tab", "Likes"}}, kept)
+
+	// 處理函式返回之後才存取的路由變數不應該被之後的請求所覆蓋。
+	for _, path := range []string{"/later/first", "/later/second"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	assert.Equal(RouteParams{{"name", "first"}}, Params(escaped[0]))
+	assert.Equal(map[string]string{"name": "first"}, Vars(escaped[0]))
+	assert.Equal(map[string]string{"name": "second"}, Vars(escaped[1]))
+
+	// `http.TimeoutHandler` 會在另一個 Goroutine 中執行處理函式，此時請求可能早已結束。
+	for _, id := range []string{"1", "2"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/slow/"+id, nil))
+		assert.Equal(http.StatusServiceUnavailable, w.Code)
+	}
+	assert.ElementsMatch([]string{"1", "2"}, []string{<-slow, <-slow})
+}
+
+func TestSplitPath(t *testing.T) {
+	assert := assert.New(t)
+	for _, path := range []string{"", "/", "//", "/a", "/a/", "/a//b", "/a/b/c", "a", "a/b"} {
+		assert.Equal(strings.Split(path, "/")[1:], splitPath([]string{}, path), path)
+	}
+}
+
+// discardResponseWriter 是不會保存任何內容的回應，避免效能測試計入 `httptest.ResponseRecorder` 的記憶體配置。
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkParams(b *testing.B) {
+	r := New()
+	r.Get("/user/{i:id}/{s:tab}", func(w http.ResponseWriter, r *http.Request) {
+		Params(r).Get("id")
+	})
+	r.Build()
+	w := &discardResponseWriter{header: make(http.Header)}
+	req := httptest.NewRequest("GET", "/user/123/posts", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+func TestRuntimeRoutes(t *testing.T) {
+	assert := assert.New(t)
+	write := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	reply := func(name string) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + ":" + varsToString(Vars(r))))
+		}
+	}
+	r := New()
+	r.Use(write("global,"))
+	api := r.Group("/api", write("api,"))
+	api.Get("/user/{id}", reply("user")).Name("user")
+	r.Get("/about", reply("about"))
+	// 在編譯之前新增的路由會在編譯時一併驗證。
+	_, err := r.AddRoute("GET", "/early", reply("early"))
+	assert.NoError(err)
+	assert.NoError(r.Build())
+
+	serve := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+	code, body := serve("/early")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("global,early:", body)
+
+	// 新增路由。
+	route, err := r.AddRoute("GET", "/post/{i:id}", reply("post"))
+	assert.NoError(err)
+	assert.Equal("GET /post/{i:id}", route.String())
+	_, body = serve("/post/12")
+	assert.Equal("global,post:12", body)
+	_, err = r.AddRoute("GET", "/post/{i:pid}", reply("post"))
+	assert.True(errors.Is(err, ErrRouteExists))
+	_, err = r.AddRoute("GET", "/about", reply("about"))
+	assert.True(errors.Is(err, ErrRouteExists))
+	_, err = api.AddNamedRoute("photo", "GET", "/photo/{id}", reply("photo"))
+	assert.NoError(err)
+	_, body = serve("/api/photo/3")
+	assert.Equal("global,api,photo:3", body)
+	path, err := r.URL("photo", map[string]string{"id": "3"})
+	assert.NoError(err)
+	assert.Equal("/api/photo/3", path)
+	_, err = r.AddNamedRoute("photo", "GET", "/photos", reply("photos"))
+	assert.True(errors.Is(err, ErrDuplicateName))
+
+	// 無效的路由會回傳錯誤，並且不會影響目前的路由表。
+	_, err = r.AddRoute("GET", "/tag/{unknown:name}", reply("tag"))
+	assert.True(errors.Is(err, ErrRuleNotFound))
+	_, err = r.AddRoute("GET", "/tag/{name}")
+	assert.True(errors.Is(err, ErrHandlerNotFound))
+	code, _ = serve("/tag/go")
+	assert.Equal(http.StatusNotFound, code)
+
+	// 替換路由會沿用原本的名稱與群組中介軟體。
+	_, err = r.ReplaceRoute("GET", "/api/user/{uid}", reply("user2"))
+	assert.NoError(err)
+	_, body = serve("/api/user/5")
+	assert.Equal("global,api,user2:5", body)
+	path, err = r.URL("user", map[string]string{"uid": "5"})
+	assert.NoError(err)
+	assert.Equal("/api/user/5", path)
+	_, err = r.ReplaceNamedRoute("photo", reply("photo2"))
+	assert.NoError(err)
+	_, body = serve("/api/photo/4")
+	assert.Equal("global,api,photo2:4", body)
+	_, err = r.ReplaceRoute("GET", "/nothing/{id}", reply("nothing"))
+	assert.True(errors.Is(err, ErrRouteNotFound))
+	_, err = r.ReplaceNamedRoute("nothing", reply("nothing"))
+	assert.True(errors.Is(err, ErrRouteNotFound))
+
+	// 移除路由。
+	assert.NoError(r.RemoveRoute("GET", "/post/{i:x}"))
+	code, _ = serve("/post/12")
+	assert.Equal(http.StatusNotFound, code)
+	assert.NoError(r.RemoveRoute("GET", "/about"))
+	code, _ = serve("/about")
+	assert.Equal(http.StatusNotFound, code)
+	assert.NoError(r.RemoveNamedRoute("photo"))
+	code, _ = serve("/api/photo/4")
+	assert.Equal(http.StatusNotFound, code)
+	_, err = r.URL("photo", map[string]string{"id": "4"})
+	assert.True(errors.Is(err, ErrRouteNotFound))
+	assert.True(errors.Is(r.RemoveRoute("GET", "/about"), ErrRouteNotFound))
+	assert.True(errors.Is(r.RemoveNamedRoute("photo"), ErrRouteNotFound))
+
+	// 定義路由的函式在編譯之後仍然會被凍結。
+	assert.PanicsWithError(ErrRouterFrozen.Error(), func() { r.Get("/late", reply("late")) })
+
+	// 嚴格模式下會拒絕和現有路由衝突的路由。
+	strict := New(Config{StrictRoutes: true})
+	strict.Get("/post/{i:id}/{tab?}", reply("post"))
+	assert.NoError(strict.Build())
+	_, err = strict.AddRoute("GET", "/post/{i:id}", reply("post"))
+	assert.True(errors.Is(err, ErrRouteConflict))
+	assert.Len(strict.current().routes, 1)
+}
+
+// TestRuntimeRoutesRace 會在處理請求的同時不斷新增、替換與移除路由，請搭配 `go test -race` 執行來檢查資料競爭。
+func TestRuntimeRoutesRace(t *testing.T) {
+	assert := assert.New(t)
+	r := New()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/stable/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable:" + Params(r).Get("id")))
+	}).Name("stable")
+	assert.NoError(r.Build())
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "/stable/"+strconv.Itoa(i), nil))
+				assert.Equal("stable:"+strconv.Itoa(i), w.Body.String())
+
+				w = httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest("GET", "/plugin/"+strconv.Itoa(i%4)+"/x", nil))
+				if w.Code == http.StatusOK {
+					assert.Regexp(`^(v1|v2):x$`, w.Body.String())
+				} else {
+					assert.Equal(http.StatusNotFound, w.Code)
+				}
+				_, err := r.URL("stable", map[string]string{"id": "1"})
+				assert.NoError(err)
+			}
+		}(i)
+	}
+	for n := 0; n < 200; n++ {
+		path := "/plugin/" + strconv.Itoa(n%4) + "/{name}"
+		_, err := r.AddRoute("GET", path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("v1:" + Params(r).Get("name")))
+		})
+		assert.NoError(err)
+		_, err = r.ReplaceRoute("GET", path, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("v2:" + Params(r).Get("name")))
+		})
+		assert.NoError(err)
+		assert.NoError(r.RemoveRoute("GET", path))
+	}
+	close(done)
+	wg.Wait()
+	assert.Len(r.current().routes, 1)
+}
@@ -0,0 +1,173 @@
+package davai
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Param 是單個路由變數的名稱與內容。
+type Param struct {
+	// Key 是路由變數的名稱。
+	Key string
+	// Value 是擷取到的內容，選擇性變數在網址中被省略時會是空字串。
+	Value string
+}
+
+// RouteParams 是依照路由定義順序排列的路由變數，由於這是個切片，因此也能直接以 `range` 逐一走訪。
+// 請求的路由變數在處理函式返回之後仍能安全地存取，但它和請求共用同一份記憶體，若需要更改內容的話應該先以 `Copy` 複製一份。
+type RouteParams []Param
+
+// Get 會回傳指定名稱的路由變數內容，不存在時會回傳空字串。
+func (ps RouteParams) Get(name string) string {
+	v, _ := ps.Lookup(name)
+	return v
+}
+
+// Lookup 會回傳指定名稱的路由變數內容，以及該變數是否存在於路由中。
+func (ps RouteParams) Lookup(name string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByIndex 會回傳路由中第 `i` 個路由變數，超出範圍時會回傳空的 `Param`。
+func (ps RouteParams) ByIndex(i int) Param {
+	if i < 0 || i >= len(ps) {
+		return Param{}
+	}
+	return ps[i]
+}
+
+// Len 會回傳路由變數的數量。
+func (ps RouteParams) Len() int {
+	return len(ps)
+}
+
+// Copy 會回傳一份路由變數的複本，更改複本並不會影響原本的路由變數。
+func (ps RouteParams) Copy() RouteParams {
+	return append(RouteParams(nil), ps...)
+}
+
+// vars 會將路由變數轉換成 `Vars` 所使用的 `map[string]string` 格式。
+func (ps RouteParams) vars() map[string]string {
+	vars := make(map[string]string, len(ps))
+	for _, p := range ps {
+		vars[p.Key] = p.Value
+	}
+	return vars
+}
+
+// reset 會清空路由變數，並依照指定的名稱建立內容為空字串的變數，這會盡可能重複使用原本的記憶體。
+func (ps *RouteParams) reset(names []string) {
+	*ps = (*ps)[:0]
+	for _, name := range names {
+		*ps = append(*ps, Param{Key: name})
+	}
+}
+
+// set 會更改指定名稱的路由變數內容。
+func (ps RouteParams) set(name string, value string) {
+	for i := range ps {
+		if ps[i].Key == name {
+			ps[i].Value = value
+			return
+		}
+	}
+}
+
+// requestParams 是保存於請求上下文中的路由變數，它同時也是請求的 `context.Context`，因此保存路由變數時不需要再透過 `context.WithValue` 配置記憶體。
+// 它並不會在請求之間重複使用，因此處理函式返回之後（例如在其他 Goroutine 或是 `http.TimeoutHandler` 中）仍能安全地存取。
+// `Vars` 與 `Values` 的結果只會在第一次呼叫時建立，因此沒有使用它們的請求就不需要額外配置記憶體。
+type requestParams struct {
+	context.Context
+	// params 是擷取到的路由變數。
+	params RouteParams
+	// route 是相符的路由，供 `Values` 轉換變數使用。
+	route *Route
+	// converted 是比對時已經以規則轉換函式轉換過的變數。
+	converted []conversion
+	// vars 是 `Vars` 所回傳的相容格式。
+	vars map[string]string
+	// varsOnce 確保 `vars` 只會被建立一次。
+	varsOnce sync.Once
+	// values 是 `Values` 所回傳的轉換結果。
+	values map[string]interface{}
+	// valuesOnce 確保 `values` 只會被轉換一次。
+	valuesOnce sync.Once
+	// paramsBuf 與 `convertedBuf` 是變數不多時所使用的空間，這讓大部分的路由只需要配置一次記憶體。
+	paramsBuf    [4]Param
+	convertedBuf [2]conversion
+}
+
+// newRequestParams 會以比對時的暫存變數建立保存於請求上下文中的路由變數。
+func newRequestParams(ctx context.Context, route *Route, b *paramsBuffer) *requestParams {
+	p := &requestParams{
+		Context: ctx,
+		route:   route,
+	}
+	p.params = append(p.paramsBuf[:0], b.params...)
+	if len(b.converted) != 0 {
+		p.converted = append(p.convertedBuf[:0], b.converted...)
+	}
+	return p
+}
+
+// Value 會在以 `paramsKey` 取得資料時回傳路由變數，其他的鍵名則交由原本的上下文處理。
+func (p *requestParams) Value(key interface{}) interface{} {
+	if key == paramsKey {
+		return p
+	}
+	return p.Context.Value(key)
+}
+
+// paramsBuffer 是比對路由時所使用的暫存變數，這會透過 `paramsPool` 在請求之間重複使用，
+// 而相符之後才會被複製到 `requestParams` 之中，因此請求永遠不會持有會被重複使用的記憶體。
+type paramsBuffer struct {
+	params    RouteParams
+	converted []conversion
+}
+
+// paramsPool 是重複使用的暫存變數。
+var paramsPool = sync.Pool{
+	New: func() interface{} {
+		return new(paramsBuffer)
+	},
+}
+
+// acquireParams 會從 `paramsPool` 中取得一個空的暫存變數。
+func acquireParams() *paramsBuffer {
+	return paramsPool.Get().(*paramsBuffer)
+}
+
+// release 會清空暫存變數並放回 `paramsPool`，這會保留切片的容量供下個請求使用。
+func (b *paramsBuffer) release() {
+	for i := range b.params {
+		b.params[i] = Param{}
+	}
+	for i := range b.converted {
+		b.converted[i] = conversion{}
+	}
+	b.params, b.converted = b.params[:0], b.converted[:0]
+	paramsPool.Put(b)
+}
+
+// Params 會回傳依照路由定義順序排列的路由變數，這不需要像 `Vars` 一樣額外建立 `map`。
+// 如果路由中有選擇性路由，且請求網址中省略了該變數，該變數仍會存在但內容是空字串。靜態路由則會回傳 `nil`。
+func Params(r *http.Request) RouteParams {
+	if p := requestParamsOf(r); p != nil {
+		return p.params
+	}
+	return nil
+}
+
+// requestParamsOf 會取得保存於請求上下文中的路由變數。
+func requestParamsOf(r *http.Request) *requestParams {
+	if v := contextGet(r, paramsKey); v != nil {
+		return v.(*requestParams)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package davai
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -23,8 +25,22 @@ type rule struct {
 	name string
 	// expr 是這個規則的表達式內容。
 	expr string
-	// regexp 是編譯後的正規表達式。
+	// regexp 是編譯後的正規表達式，僅以轉換函式驗證的規則則為 `nil`。
 	regexp *regexp.Regexp
+	// convert 是規則的轉換函式，這會在正規表達式相符之後驗證並轉換變數。
+	convert Converter
+	// chars 是此規則所能接受的所有字元，這僅有內建規則才會有，空字串表示無法得知。
+	chars string
+}
+
+// Converter 是規則的驗證與轉換函式，它會收到保留原始大小寫且經過解碼的變數內容，
+// 並回傳轉換後的值，回傳錯誤則表示此片段並不相符，路由器會繼續比對其他的路由。
+type Converter func(value string) (interface{}, error)
+
+// conversion 是比對時以規則的轉換函式轉換後的變數，這讓 `Values` 不需要再次轉換。
+type conversion struct {
+	name  string
+	value interface{}
 }
 
 // Part 呈現了路由上的其中一個片段。
@@ -52,6 +68,7 @@ type part struct {
 // Route 呈現了單個路由資訊。
 type Route struct {
 	// RegexCache 能啟用路由器的正規表達式快取，如果路由中有正規表達式規則且內容通常是固定的，那麼開啟此功能可以增進效能。
+	// 這必須在路由器編譯之前設定，執行期間新增的路由則無法更改。
 	RegexCache bool
 	// DirectoryListing 可以決定此路由所提供的靜態目錄是否允許暴露底下的檔案。
 	DirectoryListing bool
@@ -62,6 +79,8 @@ type Route struct {
 	name string
 	// path 是路由的完整路徑。
 	path string
+	// slash 表示路由在定義時是否以尾斜線結尾，這只有在嚴格區分尾斜線時才有作用。
+	slash bool
 	// method 是路由的方法。
 	method string
 	// parts 是路徑上的片段。
@@ -80,21 +99,43 @@ type Route struct {
 	// 這個的存在是用來讓 `Vars` 能夠在沒有接收到指定變數的情況下回傳一個完整的截取變數結果，
 	// 而不需要每次都完整掃描請求路由來取得空結果。
 	defaultCaptureVars map[string]string
+	// varNames 是依照定義順序排列的擷取變數名稱，比對時會依此建立 `RouteParams`。
+	varNames []string
 	// rawHandlers 是尚未分類的路由處理函式、中介軟體。
 	rawHandlers []interface{}
 	// middlewares 是這個路由的中介軟體。
 	middlewares []middleware
 	// handler 是這個路由最主要、最終的進入點處理函式。
 	handler http.Handler
+	// chain 是編譯時就已經串連好中介軟體的處理函式，每個請求都會重複使用而不需要重新串連。
+	chain http.Handler
+	// errs 是定義路由時所發現的錯誤，這會在 `Validate` 時一併回傳。
+	errs []error
 }
 
 // Name 能夠替此路由命名供稍後以反向路由的方式產生路徑。
 func (r *Route) Name(name string) *Route {
+	router := r.routeGroup.router
+	router.mutable()
+	names := router.current().names
+	if v, ok := names[name]; ok && v != r {
+		r.fail(fmt.Errorf("%w: %q is already used by %s", ErrDuplicateName, name, v))
+	}
 	r.name = name
-	r.routeGroup.router.routeNames[name] = r
+	names[name] = r
 	return r
 }
 
+// String 會回傳此路由的方法與路徑，例如 `GET /user/{id}`。
+func (r *Route) String() string {
+	return r.method + " " + r.path
+}
+
+// fail 會記錄定義此路由時所發現的錯誤。
+func (r *Route) fail(err error) {
+	r.errs = append(r.errs, err)
+}
+
 // init 能夠初始化這個路由並且解析路徑成片段供服務開始後比對。
 func (r *Route) init() *Route {
 	// 拆解路由片段。
@@ -104,6 +145,12 @@ func (r *Route) init() *Route {
 
 // AddPriority 會替此路由增加指定的優先度。
 func (r *Route) AddPriority(priority int) {
+	r.routeGroup.router.mutable()
+	r.addPriority(priority)
+}
+
+// addPriority 會替此路由增加指定的優先度，這會在解析路由時使用，因此不會檢查路由器是否已經被凍結。
+func (r *Route) addPriority(priority int) {
 	r.priority += int16(priority)
 }
 
@@ -114,9 +161,10 @@ func (r *Route) tearApart() {
 	parts := strings.Split(r.path, "/")
 
 	if r.path == "/" {
-		r.AddPriority(priorityRoot)
+		r.addPriority(priorityRoot)
 		return
 	}
+	router := r.routeGroup.router
 
 	// 遞迴每個片段，並且分析資料。
 	for _, v := range parts {
@@ -129,7 +177,11 @@ func (r *Route) tearApart() {
 		var isStatic bool
 		// 是否為 `{}` 擷取群組。
 		var isCaptureGroup bool
-		if strings.Contains(v, "{") {
+		// 格式錯誤的擷取群組無法被解析，只能先以靜態片段看待並記錄錯誤。
+		if err := checkSegment(v); err != nil {
+			r.fail(fmt.Errorf("%w: route %s has %v", ErrInvalidPath, r, err))
+			isStatic = true
+		} else if strings.Contains(v, "{") {
 			isCaptureGroup = true
 			r.hasCaptureGroup = true
 			r.isStatic = false
@@ -180,15 +232,25 @@ func (r *Route) tearApart() {
 		// 取得相對應的規則建構體。
 		var rule *rule
 		if ruleName != "" {
-			rule = r.routeGroup.router.rules[ruleName]
+			rule = router.rules[ruleName]
+			// 未定義的規則會在比對時造成 panic，因此以一般的擷取群組看待並記錄錯誤。
+			if rule == nil {
+				r.fail(fmt.Errorf("%w: route %s uses %q", ErrRuleNotFound, r, ruleName))
+				isRegExp = false
+			}
+		}
+		// 靜態內容必須和請求網址使用相同的格式才能比對。
+		path := router.normalize(v)
+		if isStatic {
+			path = router.segment(v)
 		}
 		// 整理此片段。
 		r.parts = append(r.parts, &part{
 			rule:           rule,
 			name:           varName,
-			path:           strings.ToLower(v),
-			prefix:         strings.ToLower(prefix),
-			suffix:         strings.ToLower(suffix),
+			path:           path,
+			prefix:         router.segment(prefix),
+			suffix:         router.segment(suffix),
 			isStatic:       isStatic,
 			isCaptureGroup: isCaptureGroup,
 			isRegExp:       isRegExp,
@@ -199,28 +261,286 @@ func (r *Route) tearApart() {
 			if r.defaultCaptureVars == nil {
 				r.defaultCaptureVars = make(map[string]string)
 			}
+			if _, ok := r.defaultCaptureVars[varName]; ok {
+				r.fail(fmt.Errorf("%w: route %s captures %q more than once", ErrInvalidPath, r, varName))
+			} else {
+				r.varNames = append(r.varNames, varName)
+			}
 			r.defaultCaptureVars[varName] = ""
 		}
-		r.AddPriority(priorityPath)
+		r.addPriority(priorityPath)
 		if prefix != "" {
-			r.AddPriority(priorityText)
+			r.addPriority(priorityText)
 		}
 		if suffix != "" {
-			r.AddPriority(priorityText)
+			r.addPriority(priorityText)
 		}
 		if isCaptureGroup {
-			r.AddPriority(priorityGroup)
+			r.addPriority(priorityGroup)
 			if isRegExp {
-				r.AddPriority(priorityRegExp)
+				r.addPriority(priorityRegExp)
 				if ruleName == "*" {
-					r.AddPriority(priorityAnyRegExp)
+					r.addPriority(priorityAnyRegExp)
 				}
 			}
 			if isOptional {
-				r.AddPriority(priorityOptional)
+				r.addPriority(priorityOptional)
 			}
 		} else {
-			r.AddPriority(priorityStatic)
+			r.addPriority(priorityStatic)
+		}
+	}
+	// 嚴格區分尾斜線時，尾斜線會被視為一個空白的靜態片段，這樣 `/users/` 就只會符合以尾斜線定義的路由。
+	if r.slash && router.strictSlash() {
+		r.len++
+		r.parts = append(r.parts, &part{
+			isStatic: true,
+		})
+		r.addPriority(priorityPath)
+		r.addPriority(priorityStatic)
+	}
+}
+
+// staticPath 會回傳此路由於靜態路由表中的鍵名。
+func (r *Route) staticPath() string {
+	router := r.routeGroup.router
+	if r.slash && router.strictSlash() {
+		return router.segment(r.path + "/")
+	}
+	return router.segment(r.path)
+}
+
+// original 會從原始網址片段中取得擷取到的內容，以保留變數原本的大小寫。
+// 由於 `toLower` 不會改變字串的長度，小寫網址片段中的前後輟位置和原始網址片段完全相同。
+func (p *part) original(original string) string {
+	return original[len(p.prefix) : len(original)-len(p.suffix)]
+}
+
+// escape 會將變數內容編碼成能夠安插於此片段的格式，任意規則的內容能夠跨越多個片段，因此會保留其中的 `/`。
+func (p *part) escape(value string) string {
+	if !p.isAny() {
+		return url.PathEscape(value)
+	}
+	segments := strings.Split(value, "/")
+	for k, v := range segments {
+		segments[k] = url.PathEscape(v)
+	}
+	return strings.Join(segments, "/")
+}
+
+// accepts 表示此片段在比對時是否會接受指定的變數內容。
+func (p *part) accepts(router *Router, value string) bool {
+	// 除了任意規則之外，未以編碼網址比對時，變數中的 `/` 會在請求時被解碼並將片段一分為二。
+	if value == "" || (!router.UseRawPath && !p.isAny() && strings.Contains(value, "/")) {
+		return false
+	}
+	// `.` 與 `..` 片段會被瀏覽器解析成上一層，因此產生的網址會指向其他的路徑。
+	segment := p.prefix + value + p.suffix
+	if p.isAny() {
+		for _, v := range strings.Split(segment, "/") {
+			if v == "." || v == ".." {
+				return false
+			}
+		}
+	} else if segment == "." || segment == ".." {
+		return false
+	}
+	if !p.isRegExp {
+		return true
+	}
+	// 比對時是以（不區分大小寫時為小寫的）網址片段來驗證規則，因此這裡也必須以相同的格式驗證。
+	component := value
+	if router.UseRawPath {
+		component = p.escape(value)
+	}
+	_, ok := p.check(router.normalize(component), value, false)
+	return ok
+}
+
+// check 會以此片段的規則驗證網址片段，正規表達式驗證的是標準化後的 `component`，
+// 而轉換函式則會收到保留原始大小寫的 `value`，當 `unescape` 為真時會先經過解碼。相符時會一併回傳轉換後的值。
+func (p *part) check(component string, value string, unescape bool) (interface{}, bool) {
+	if p.rule.regexp != nil && !p.rule.regexp.MatchString(component) {
+		return nil, false
+	}
+	if p.rule.convert == nil {
+		return nil, true
+	}
+	if unescape {
+		v, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, false
+		}
+		value = v
+	}
+	v, err := p.rule.convert(value)
+	return v, err == nil
+}
+
+// converts 表示此片段的變數是否會經過規則的轉換函式。
+func (p *part) converts() bool {
+	return p.isRegExp && p.rule.convert != nil
+}
+
+// convert 會以規則的轉換函式轉換擷取到的變數，沒有任何轉換函式時會回傳 `nil`。
+// 已經在比對時轉換過的變數（`converted`）會直接沿用，只有其他的變數（例如從快取取得的結果）才會在此轉換。
+func (r *Route) convert(params RouteParams, converted []conversion) map[string]interface{} {
+	var values map[string]interface{}
+partLoop:
+	for _, part := range r.parts {
+		if part.rule == nil || part.rule.convert == nil {
+			continue
+		}
+		value := params.Get(part.name)
+		if value == "" {
+			continue
+		}
+		for _, c := range converted {
+			if c.name == part.name {
+				if values == nil {
+					values = make(map[string]interface{})
+				}
+				values[part.name] = c.value
+				continue partLoop
+			}
+		}
+		v, err := part.rule.convert(value)
+		if err != nil {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		values[part.name] = v
+	}
+	return values
+}
+
+// generate 會依照傳入的變數反向產生此路由的路徑。
+// 沒有傳入的選擇性變數會被省略，若該片段帶有前後輟則會保留前後輟，如此一來產生的路徑才能再次和此路由相符。
+func (r *Route) generate(vars map[string]string) (string, error) {
+	router := r.routeGroup.router
+	segments := make([]string, 0, len(r.parts))
+	// omitted 是結尾連續被完全省略的選擇性片段數量，這些片段最後會被移除。
+	var omitted int
+	for _, part := range r.parts {
+		if !part.isCaptureGroup {
+			segments = append(segments, part.path)
+			omitted = 0
+			continue
+		}
+		value, ok := vars[part.name]
+		if !ok && !part.isOptional {
+			return "", fmt.Errorf("%w: route %q requires %q", ErrVarNotFound, r.name, part.name)
+		}
+		if value == "" && part.isOptional {
+			segments = append(segments, part.prefix+part.suffix)
+			if part.prefix == "" && part.suffix == "" {
+				omitted++
+			} else {
+				omitted = 0
+			}
+			continue
+		}
+		if !part.accepts(router, value) {
+			return "", fmt.Errorf("%w: route %q does not accept %q as %q", ErrVarMismatch, r.name, value, part.name)
+		}
+		segments = append(segments, part.prefix+part.escape(value)+part.suffix)
+		omitted = 0
+	}
+	segments = segments[:len(segments)-omitted]
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// match 會檢查此路由是否和網址片段相符，擷取到的變數則會被寫入 `params` 之中，而規則的轉換結果則會被寫入 `values`（能夠是 `nil`）。
+// 比對時使用的是小寫的 `components`，而擷取到的變數則是取自保留原始大小寫的 `originals`。
+func (r *Route) match(components []string, originals []string, params *RouteParams, values *[]conversion) bool {
+	var matched bool
+	componentLength := len(components)
+	params.reset(r.varNames)
+	vars := *params
+	if values != nil {
+		*values = (*values)[:0]
+	}
+	partLength := len(r.parts)
+
+partScan:
+	for index, part := range r.parts {
+		component := components[index]
+		isLastComponent := index == componentLength-1
+		isLastPart := index == partLength-1
+
+		switch {
+		case part.isStatic:
+			if part.path != component {
+				break partScan
+			}
+		case part.isCaptureGroup:
+			if part.prefix != "" {
+				if !strings.HasPrefix(component, part.prefix) {
+					break partScan
+				}
+				component = strings.TrimPrefix(component, part.prefix)
+			}
+			if part.suffix != "" {
+				if !strings.HasSuffix(component, part.suffix) {
+					break partScan
+				}
+				component = strings.TrimSuffix(component, part.suffix)
+			}
+			if part.prefix != "" || part.suffix != "" {
+				if !part.isOptional && !part.isRegExp && component == "" {
+					break partScan
+				}
+			}
+			if part.isRegExp {
+				if part.rule.name == "*" {
+					if isLastPart {
+						vars.set(part.name, strings.Join(originals[index:], "/"))
+						matched = true
+						break partScan
+					}
+				}
+			}
+			value := part.original(originals[index])
+			if part.isRegExp {
+				if (part.isOptional && component != "") || !part.isOptional {
+					v, ok := part.check(component, value, r.routeGroup.router.UseRawPath)
+					if !ok {
+						break partScan
+					}
+					if values != nil && part.converts() {
+						*values = append(*values, conversion{part.name, v})
+					}
+				}
+			}
+			vars.set(part.name, value)
+		}
+		if !isLastPart {
+			if component != "" {
+				nextPart := r.parts[index+1]
+				if nextPart.isOptional {
+					if isLastComponent {
+						matched = true
+						break
+					}
+				}
+				if nextPart.isRegExp {
+					if nextPart.rule.name == "*" {
+						vars.set(nextPart.name, strings.Join(originals[index+1:], "/"))
+						matched = true
+						break partScan
+					}
+				}
+			}
+		}
+		if isLastPart && isLastComponent {
+			matched = true
+			break
+		}
+		if isLastComponent {
+			break
 		}
 	}
+	return matched
 }
@@ -11,45 +11,51 @@ type RouteGroup struct {
 	router *Router
 	// prefix 是這個路由群組的前輟路徑。
 	prefix string
-	// routes 表示這個群組內的路由。
+	// routes 表示這個群組內於定義時所建立的路由，執行期間的路由更動並不會反映在此。
 	routes []*Route
 	// middlewares 是這個路由群組的共享中介軟體。
 	middlewares []middleware
+	// optionsChain 是自動回應 OPTIONS 請求時，串連了全域與此群組中介軟體的處理函式。
+	optionsChain http.Handler
 }
 
 // newRoute 會在目前的路由群組中依指定的方法、路徑、處理函式來插入新的路由。
 func (r *RouteGroup) newRoute(method string, path string, handlers ...interface{}) *Route {
+	r.router.mutable()
+	route := r.route(method, path, handlers)
+	// 保存路由至此群組。
+	r.routes = append(r.routes, route)
+	// 保存路由至此路由器，並依照動態和靜態保存到不同的路由表中。
+	r.router.current().insert(route)
+	return route
+}
+
+// route 會依照此群組的前輟建立並初始化一個新的路由，但並不會將其保存至路由器中。
+func (r *RouteGroup) route(method string, path string, handlers []interface{}) *Route {
 	if path == "/" {
 		if r.prefix != "" {
 			path = ""
 		}
 	}
+	var slash bool
 	if path != "/" {
+		slash = strings.HasSuffix(path, "/")
 		path = strings.TrimRight(r.prefix+path, "/")
 	}
 	route := &Route{
 		routeGroup:  r,
 		path:        path,
+		slash:       slash,
 		rawHandlers: handlers,
 		method:      method,
 	}
 	// 初始化路由。
-	route.init()
-	// 保存路由至此群組。
-	r.routes = append(r.routes, route)
-	// 保存路由至此路由器。
-	r.router.routes = append(r.router.routes, route)
-	// 將路由依照動態和靜態保存到不同的路由樹中。
-	if route.isStatic {
-		r.router.methodRoutes[route.method].statics[route.path] = route
-	} else {
-		r.router.methodRoutes[route.method].dynamics = append(r.router.methodRoutes[route.method].dynamics, route)
-	}
-	return route
+	return route.init()
 }
 
 // Use 能將傳入的中介軟體作為群組中介軟體在群組內的所有路由中使用。
 func (r *RouteGroup) Use(middlewares ...interface{}) *RouteGroup {
+	r.router.mutable()
 	for _, v := range middlewares {
 		switch t := v.(type) {
 		// 中介軟體。
@@ -92,3 +98,38 @@ func (r *RouteGroup) Delete(path string, handlers ...interface{}) *Route {
 func (r *RouteGroup) Options(path string, handlers ...interface{}) *Route {
 	return r.newRoute("OPTIONS", path, handlers...)
 }
+
+// Head 會依照 HEAD 方法建立相對應的路由。
+func (r *RouteGroup) Head(path string, handlers ...interface{}) *Route {
+	return r.newRoute("HEAD", path, handlers...)
+}
+
+// Connect 會依照 CONNECT 方法建立相對應的路由。
+func (r *RouteGroup) Connect(path string, handlers ...interface{}) *Route {
+	return r.newRoute("CONNECT", path, handlers...)
+}
+
+// Trace 會依照 TRACE 方法建立相對應的路由。
+func (r *RouteGroup) Trace(path string, handlers ...interface{}) *Route {
+	return r.newRoute("TRACE", path, handlers...)
+}
+
+// Handle 會依照指定的方法建立相對應的路由，這能用來建立如 WebDAV 的 PROPFIND、MKCOL 等自訂方法的路由。
+// 方法名稱會區分大小寫，如同 HTTP 標準所定義的那樣。
+func (r *RouteGroup) Handle(method string, path string, handlers ...interface{}) *Route {
+	return r.newRoute(method, path, handlers...)
+}
+
+// Any 會替所有標準的 HTTP 方法建立相對應的路由。
+func (r *RouteGroup) Any(path string, handlers ...interface{}) []*Route {
+	return r.Match(anyMethods, path, handlers...)
+}
+
+// Match 會替傳入的每個方法建立相對應的路由。
+func (r *RouteGroup) Match(methods []string, path string, handlers ...interface{}) []*Route {
+	var routes []*Route
+	for _, method := range methods {
+		routes = append(routes, r.newRoute(method, path, handlers...))
+	}
+	return routes
+}
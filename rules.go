@@ -0,0 +1,109 @@
+package davai
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errRuleMismatch 表示變數不符合內建規則的轉換函式。
+var errRuleMismatch = errors.New("davai: the variable does not match the rule")
+
+// registerRules 會在路由器中註冊內建的規則，這些規則能直接在路由中使用，例如 `/user/{uuid:id}`。
+// 以相同的名稱呼叫 `Rule` 或 `RuleFunc` 就能覆蓋內建的規則。
+//
+//	i          數字，轉換成 `int64`，溢位時仍相符但轉換結果為 `nil`
+//	s          英文字母與數字
+//	int        有號整數，溢位時不相符，轉換成 `int64`
+//	uint       無號整數，溢位時不相符，轉換成 `uint64`
+//	uuid       `xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx` 格式的 UUID，轉換成 `[16]byte`
+//	ulid       ULID
+//	slug       以 `-` 連接的英文字母與數字，例如 `hello-world`
+//	hex        十六進位字串
+//	base64url  網址安全的 Base64 字串
+//	date       `YYYY-MM-DD` 格式的日期，必須是實際存在的日期，轉換成 `time.Time`
+//	semver     語意化版本，例如 `1.2.3-beta.1+build.5`
+//	alpha      英文字母
+//	lower      小寫英文字母，即使路由不區分大小寫也會驗證原始網址的大小寫
+//	locale     語系標籤，例如 `en`、`zh-TW` 或 `zh-Hant-TW`
+//	*          任意內容，能夠跨越多個片段
+func registerRules(r *Router) {
+	r.Rule("*", ".*")
+	r.Rule("i", "[0-9]+", func(v string) (interface{}, error) {
+		// 為了相容，`i` 規則接受任意長度的數字，因此溢位時不能回傳錯誤。
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+		return nil, nil
+	})
+	r.Rule("s", "[0-9A-Za-z]+")
+	r.RuleFunc("int", parseInt)
+	r.RuleFunc("uint", func(v string) (interface{}, error) {
+		return strconv.ParseUint(v, 10, 64)
+	})
+	r.RuleFunc("uuid", parseUUID)
+	r.Rule("ulid", "(?i:[0-7][0-9a-hjkmnp-tv-z]{25})")
+	r.Rule("slug", "[0-9A-Za-z]+(?:-[0-9A-Za-z]+)*")
+	r.Rule("hex", "[0-9A-Fa-f]+")
+	r.Rule("base64url", "[0-9A-Za-z_-]+={0,2}")
+	r.RuleFunc("date", func(v string) (interface{}, error) {
+		return time.Parse("2006-01-02", v)
+	})
+	r.Rule("semver", `(?:0|[1-9][0-9]*)\.(?:0|[1-9][0-9]*)\.(?:0|[1-9][0-9]*)(?:-[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?`)
+	r.Rule("alpha", "[A-Za-z]+")
+	r.RuleFunc("lower", func(v string) (interface{}, error) {
+		if v == "" || strings.IndexFunc(v, func(c rune) bool { return c < 'a' || c > 'z' }) != -1 {
+			return nil, errRuleMismatch
+		}
+		return v, nil
+	})
+	r.Rule("locale", "(?i:[a-z]{2,3}(?:-[a-z]{4})?(?:-(?:[a-z]{2}|[0-9]{3}))?)")
+	for name, chars := range ruleChars {
+		r.rules[name].chars = chars
+	}
+}
+
+const (
+	// digits 是所有的數字。
+	digits = "0123456789"
+	// letters 是所有的英文字母。
+	letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+)
+
+// ruleChars 是內建規則所能接受的字元，`Conflicts` 會以此判斷兩個不同的規則是否不可能符合相同的內容，
+// 例如 `i` 與 `alpha` 並不相交，但 `i` 與 `s` 則會。以相同名稱覆蓋的規則則會被視為無法得知。
+var ruleChars = map[string]string{
+	"i":         digits,
+	"s":         digits + letters,
+	"int":       digits + "+-",
+	"uint":      digits + "+",
+	"uuid":      digits + letters[:6] + letters[26:32] + "-",
+	"ulid":      digits + letters,
+	"slug":      digits + letters + "-",
+	"hex":       digits + letters[:6] + letters[26:32],
+	"base64url": digits + letters + "_-=",
+	"date":      digits + "-",
+	"semver":    digits + letters + ".-+",
+	"alpha":     letters,
+	"lower":     letters[:26],
+	"locale":    digits + letters + "-",
+}
+
+// parseInt 會將十進位的整數轉換成 `int64`。
+func parseInt(v string) (interface{}, error) {
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// parseUUID 會將標準格式的 UUID 轉換成 `[16]byte`。
+func parseUUID(v string) (interface{}, error) {
+	var id [16]byte
+	if !isUUID(v) {
+		return id, errRuleMismatch
+	}
+	if _, err := hex.Decode(id[:], []byte(strings.Replace(v, "-", "", -1))); err != nil {
+		return id, err
+	}
+	return id, nil
+}
@@ -0,0 +1,368 @@
+package davai
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// routeTable 是路由器在某個時間點的完整路由表。路由器編譯之後路由表就不會再被更改，
+// 執行期間的路由更動會複製一份新的路由表，在驗證並編譯完畢之後才以 `atomic` 替換，
+// 因此請求永遠不需要取得鎖，而正在處理中的請求也會繼續使用舊的路由表直到結束。
+type routeTable struct {
+	// routes 是現有的全部路由，依照定義的順序排列。
+	routes []*Route
+	// names 是用來存放已命名的路由供之後取得。
+	names map[string]*Route
+	// methods 是以不同方法作為鍵名區分的所有路由。
+	methods map[string]*routes
+}
+
+// newRouteTable 會建立一個空的路由表。
+func newRouteTable() *routeTable {
+	return &routeTable{
+		names:   make(map[string]*Route),
+		methods: make(map[string]*routes),
+	}
+}
+
+// current 會取得目前的路由表，這不需要取得任何鎖。
+func (r *Router) current() *routeTable {
+	return r.table.Load().(*routeTable)
+}
+
+// clone 會複製此路由表，各方法的路由則會共用，直到透過 `writable` 更動時才會複製。
+func (t *routeTable) clone() *routeTable {
+	c := &routeTable{
+		routes:  append([]*Route(nil), t.routes...),
+		names:   make(map[string]*Route, len(t.names)),
+		methods: make(map[string]*routes, len(t.methods)),
+	}
+	for k, v := range t.names {
+		c.names[k] = v
+	}
+	for k, v := range t.methods {
+		c.methods[k] = v
+	}
+	return c
+}
+
+// writable 會複製指定方法的路由，讓接下來的更動不會影響到仍在使用舊路由表的請求。
+func (t *routeTable) writable(method string) {
+	if v, ok := t.methods[method]; ok {
+		t.methods[method] = v.clone()
+	}
+}
+
+// methodTable 會取得指定方法的路由，若該方法尚無任何路由則會建立一個新的。
+func (t *routeTable) methodTable(method string) *routes {
+	v, ok := t.methods[method]
+	if !ok {
+		v = &routes{
+			method:  method,
+			statics: make(map[string]*Route),
+			cache:   newCache(defaultCacheSize),
+		}
+		t.methods[method] = v
+	}
+	return v
+}
+
+// insert 會將路由保存至路由表，並依照動態和靜態保存到不同的路由中。
+func (t *routeTable) insert(route *Route) {
+	t.routes = append(t.routes, route)
+	v := t.methodTable(route.method)
+	if route.isStatic {
+		v.statics[route.staticPath()] = route
+	} else {
+		v.dynamics = append(v.dynamics, route)
+		v.invalidate()
+	}
+}
+
+// remove 會從路由表中移除指定的路由，沒有任何路由的方法也會一併被移除。
+func (t *routeTable) remove(route *Route) {
+	t.routes = removeRoute(t.routes, route)
+	if route.name != "" && t.names[route.name] == route {
+		delete(t.names, route.name)
+	}
+	v := t.methods[route.method]
+	if route.isStatic {
+		if v.statics[route.staticPath()] == route {
+			delete(v.statics, route.staticPath())
+		}
+	} else {
+		v.dynamics = removeRoute(v.dynamics, route)
+		v.invalidate()
+	}
+	if len(v.statics) == 0 && len(v.dynamics) == 0 {
+		delete(t.methods, route.method)
+	}
+}
+
+// swap 會以新的路由替換 `old` 與所有和其相符的路由，新的路由會取代 `old` 的位置，
+// 並沿用其名稱、優先度、設定與所屬的路由群組（及其中介軟體）。
+func (t *routeTable) swap(old *Route, matches []*Route, route *Route) {
+	route.routeGroup = old.routeGroup
+	route.name = old.name
+	route.priority = old.priority
+	route.RegexCache = old.RegexCache
+	route.DirectoryListing = old.DirectoryListing
+
+	t.writable(route.method)
+	for _, v := range matches {
+		if v != old {
+			t.remove(v)
+		}
+	}
+	replaceRoute(t.routes, old, route)
+	v := t.methods[route.method]
+	if route.isStatic {
+		v.statics[route.staticPath()] = route
+	} else {
+		replaceRoute(v.dynamics, old, route)
+		v.invalidate()
+	}
+	if route.name != "" {
+		t.names[route.name] = route
+	}
+}
+
+// matching 會依照定義的順序回傳和指定路由方法相同，且會符合完全相同網址的所有路由。
+func (t *routeTable) matching(route *Route) []*Route {
+	var matches []*Route
+	pattern := route.pattern()
+	for _, v := range t.routes {
+		if v.method == route.method && v.pattern() == pattern {
+			matches = append(matches, v)
+		}
+	}
+	return matches
+}
+
+// active 會回傳相符的路由中實際會被比對到的路由，靜態路由是最後定義的路由，而動態路由則是優先度最高且最先定義的路由。
+func active(matches []*Route) *Route {
+	winner := matches[0]
+	for _, v := range matches[1:] {
+		if v.isStatic || v.priority > winner.priority {
+			winner = v
+		}
+	}
+	return winner
+}
+
+// removeRoute 會回傳一個不包含指定路由的新切片。
+func removeRoute(routes []*Route, route *Route) []*Route {
+	result := make([]*Route, 0, len(routes))
+	for _, v := range routes {
+		if v != route {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// replaceRoute 會在切片中以新的路由取代舊的路由。
+func replaceRoute(routes []*Route, old *Route, route *Route) {
+	for i, v := range routes {
+		if v == old {
+			routes[i] = route
+		}
+	}
+}
+
+// clone 會複製此方法的路由，複製後的路由樹需要重新編譯，並且會使用新的比對快取，
+// 這避免了仍在使用舊路由表的請求將過時的比對結果保存到新的快取中。
+func (r *routes) clone() *routes {
+	c := &routes{
+		method:   r.method,
+		statics:  make(map[string]*Route, len(r.statics)),
+		dynamics: append([]*Route(nil), r.dynamics...),
+		cache:    newCache(defaultCacheSize),
+	}
+	for k, v := range r.statics {
+		c.statics[k] = v
+	}
+	return c
+}
+
+// invalidate 會在動態路由有所變動時捨棄路由樹，需要等到下次編譯時重新建立，而先前的比對快取也不再可信。
+func (r *routes) invalidate() {
+	r.tree = nil
+	r.useCache = false
+	r.cache.purge()
+}
+
+// compile 會依照優先度重新排序動態路由並編譯路由樹。
+func (r *routes) compile() {
+	sortByPriority(r.dynamics)
+	r.tree = buildTree(r.dynamics)
+	// 路由的順序可能有所改變，因此先前的比對快取已經不再可信。
+	r.cache.purge()
+	r.useCache = false
+	for _, route := range r.dynamics {
+		if route.RegexCache {
+			r.useCache = true
+			break
+		}
+	}
+}
+
+// update 會在複製的路由表上套用更動，並在驗證 `fn` 所新增的路由、編譯有所變動的方法之後，才以 `atomic` 替換目前的路由表。
+// 更動之間會透過 `mutex` 依序進行，驗證失敗時目前的路由表則不會有任何改變。尚未編譯的路由器會等到 `Build` 時才一併編譯。
+func (r *Router) update(fn func(t *routeTable) ([]*Route, error)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	current := r.current()
+	t := current.clone()
+	added, err := fn(t)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, route := range added {
+		errs = append(errs, route.validate()...)
+	}
+	if r.StrictRoutes {
+		for _, v := range t.conflicts() {
+			for _, route := range added {
+				if v.Route == route || v.Winner == route {
+					errs = append(errs, fmt.Errorf("%w: %s", ErrRouteConflict, v))
+					break
+				}
+			}
+		}
+	}
+	if err := joinErrors(errs); err != nil {
+		return err
+	}
+	if atomic.LoadUint32(&r.built) == 1 {
+		for _, route := range added {
+			r.compose(route)
+		}
+		for method, v := range t.methods {
+			if current.methods[method] != v {
+				v.compile()
+			}
+		}
+	}
+	r.table.Store(t)
+	return nil
+}
+
+// AddRoute 能夠在路由器執行期間新增一個路由，這能夠安全地與正在處理中的請求同時呼叫，請求也不需要因此取得任何鎖。
+// 路由會套用全域中介軟體，而路由的錯誤會如同 `Validate` 那樣回傳，此時路由表不會有任何改變。
+// 若已經有相同方法且符合完全相同網址的路由則會回傳 `ErrRouteExists` 錯誤，這種情況應該改用 `ReplaceRoute`。
+// 回傳的路由在回傳之前就已經被編譯並開始接收請求，因此必須被視為唯讀的，之後再更改其欄位（例如 `RegexCache`）不但不會生效，
+// 還會和正在讀取它的請求發生競爭。
+func (r *Router) AddRoute(method string, path string, handlers ...interface{}) (*Route, error) {
+	return r.routeGroups[0].AddRoute(method, path, handlers...)
+}
+
+// AddNamedRoute 和 `AddRoute` 相同，但會替新增的路由命名，若名稱已經被其他路由使用則會回傳 `ErrDuplicateName` 錯誤。
+func (r *Router) AddNamedRoute(name string, method string, path string, handlers ...interface{}) (*Route, error) {
+	return r.routeGroups[0].AddNamedRoute(name, method, path, handlers...)
+}
+
+// AddRoute 能夠在路由器執行期間於此群組新增一個路由，路由會套用此群組的前輟與中介軟體，其餘與 `Router.AddRoute` 相同。
+func (r *RouteGroup) AddRoute(method string, path string, handlers ...interface{}) (*Route, error) {
+	return r.AddNamedRoute("", method, path, handlers...)
+}
+
+// AddNamedRoute 和 `AddRoute` 相同，但會替新增的路由命名，空白的名稱表示不命名。
+func (r *RouteGroup) AddNamedRoute(name string, method string, path string, handlers ...interface{}) (*Route, error) {
+	route := r.route(method, path, handlers)
+	route.name = name
+	err := r.router.update(func(t *routeTable) ([]*Route, error) {
+		if matches := t.matching(route); len(matches) != 0 {
+			return nil, fmt.Errorf("%w: %s matches the same urls as %s", ErrRouteExists, route, matches[0])
+		}
+		if v, ok := t.names[name]; ok && name != "" {
+			return nil, fmt.Errorf("%w: %q is already used by %s", ErrDuplicateName, name, v)
+		}
+		t.writable(route.method)
+		t.insert(route)
+		if name != "" {
+			t.names[name] = route
+		}
+		return []*Route{route}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// ReplaceRoute 能夠在路由器執行期間以新的處理函式替換相同方法且符合完全相同網址的路由，路徑必須是包含群組前輟的完整路徑。
+// 新的路由會沿用原本路由的名稱、優先度、`RegexCache` 與所屬的路由群組（及其中介軟體），沒有相符的路由時會回傳 `ErrRouteNotFound` 錯誤。
+// 回傳的路由和 `AddRoute` 一樣是唯讀的。
+func (r *Router) ReplaceRoute(method string, path string, handlers ...interface{}) (*Route, error) {
+	route := r.routeGroups[0].route(method, path, handlers)
+	err := r.update(func(t *routeTable) ([]*Route, error) {
+		matches := t.matching(route)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrRouteNotFound, route)
+		}
+		t.swap(active(matches), matches, route)
+		return []*Route{route}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// ReplaceNamedRoute 能夠在路由器執行期間以新的處理函式替換指定名稱的路由，其餘與 `ReplaceRoute` 相同。
+func (r *Router) ReplaceNamedRoute(name string, handlers ...interface{}) (*Route, error) {
+	var route *Route
+	err := r.update(func(t *routeTable) ([]*Route, error) {
+		old, ok := t.names[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrRouteNotFound, name)
+		}
+		route = (&Route{
+			routeGroup:  old.routeGroup,
+			path:        old.path,
+			slash:       old.slash,
+			rawHandlers: handlers,
+			method:      old.method,
+		}).init()
+		t.swap(old, t.matching(old), route)
+		return []*Route{route}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// RemoveRoute 能夠在路由器執行期間移除相同方法且符合完全相同網址的所有路由，路徑必須是包含群組前輟的完整路徑。
+// 正在處理中的請求仍會完成，而之後的請求就不會再比對到這些路由。沒有相符的路由時會回傳 `ErrRouteNotFound` 錯誤。
+func (r *Router) RemoveRoute(method string, path string) error {
+	probe := r.routeGroups[0].route(method, path, nil)
+	return r.update(func(t *routeTable) ([]*Route, error) {
+		matches := t.matching(probe)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrRouteNotFound, probe)
+		}
+		t.writable(method)
+		for _, v := range matches {
+			t.remove(v)
+		}
+		return nil, nil
+	})
+}
+
+// RemoveNamedRoute 能夠在路由器執行期間移除指定名稱的路由，以及其他和其符合完全相同網址的路由，其餘與 `RemoveRoute` 相同。
+func (r *Router) RemoveNamedRoute(name string) error {
+	return r.update(func(t *routeTable) ([]*Route, error) {
+		old, ok := t.names[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrRouteNotFound, name)
+		}
+		t.writable(old.method)
+		for _, v := range t.matching(old) {
+			t.remove(v)
+		}
+		return nil, nil
+	})
+}
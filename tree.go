@@ -0,0 +1,300 @@
+package davai
+
+import (
+	"strings"
+	"sync"
+)
+
+// node 是動態路由樹上的單個節點，每個節點都對應到路由中的某個片段。
+// 路徑開頭相同的動態路由會共享同一條分支，這讓比對時不需要逐一掃描所有路由。
+type node struct {
+	// part 是通往此節點的路由片段，根節點則為 `nil`。
+	part *part
+	// statics 是以靜態片段路徑作為鍵名的子節點。
+	statics map[string]*node
+	// dynamics 是擷取群組的子節點，依照子樹中最佳的排名由高至低排列。
+	dynamics []*node
+	// route 是在此節點結束的路由中，排名最高的路由。
+	route *Route
+	// rank 是 `route` 於排序後動態路由中的索引。
+	rank int
+	// best 是整個子樹中排名最高的路由。
+	best *Route
+	// bestRank 是 `best` 於排序後動態路由中的索引。
+	bestRank int
+	// optional 是在此節點的片段為可選靜態片段的路由中，排名最高的路由。
+	// 可選與必要的靜態片段會共享同一個節點，因此必須另外記錄才能在網址到底時省略此片段。
+	optional *Route
+	// optionalRank 是 `optional` 於排序後動態路由中的索引。
+	optionalRank int
+}
+
+// capture 是比對路由樹時所擷取到的單個變數。
+type capture struct {
+	name  string
+	value string
+	// converted 是規則轉換函式的結果，僅在 `converts` 為真時有效。
+	converted interface{}
+	converts  bool
+}
+
+// treeMatch 是單次路由樹比對的狀態。
+type treeMatch struct {
+	// components 是請求網址的小寫片段，用來比對路由。
+	components []string
+	// originals 是請求網址保留原始大小寫的片段，用來取得擷取變數。
+	originals []string
+	// stack 是目前分支上已擷取的變數。
+	stack []capture
+	// route 是目前找到排名最高的路由。
+	route *Route
+	// rank 是 `route` 的排名。
+	rank int
+	// vars 是 `route` 所擷取的變數。
+	vars []capture
+	// unescape 表示網址片段尚未經過解碼，規則的轉換函式必須先解碼才能驗證。
+	unescape bool
+}
+
+// newNode 會建立一個新的路由樹節點。
+func newNode(p *part) *node {
+	return &node{
+		part:         p,
+		rank:         -1,
+		bestRank:     -1,
+		optionalRank: -1,
+	}
+}
+
+// key 會回傳此片段於路由樹中的識別名稱，相同識別名稱的片段會共享同一個節點。
+func (p *part) key() string {
+	var rule string
+	if p.rule != nil {
+		rule = p.rule.name
+	}
+	var optional string
+	if p.isOptional {
+		optional = "?"
+	}
+	return p.prefix + "{" + rule + ":" + p.name + optional + "}" + p.suffix
+}
+
+// isAny 表示此片段是否使用了 `*` 任意規則。
+func (p *part) isAny() bool {
+	return p.isRegExp && p.rule != nil && p.rule.name == "*"
+}
+
+// buildTree 會將已經依照優先度排序的動態路由編譯成一個路由樹。
+func buildTree(dynamics []*Route) *node {
+	root := newNode(nil)
+	for rank, route := range dynamics {
+		n := root
+		n.mark(route, rank)
+		for _, p := range route.parts {
+			n = n.child(p)
+			n.mark(route, rank)
+			if p.isStatic && p.isOptional && n.optionalRank == -1 {
+				n.optional = route
+				n.optionalRank = rank
+			}
+		}
+		if n.rank == -1 {
+			n.route = route
+			n.rank = rank
+		}
+	}
+	root.sort()
+	return root
+}
+
+// child 會取得指定片段的子節點，若不存在則建立一個新的。
+func (n *node) child(p *part) *node {
+	if p.isStatic {
+		if n.statics == nil {
+			n.statics = make(map[string]*node)
+		}
+		c, ok := n.statics[p.path]
+		if !ok {
+			c = newNode(p)
+			n.statics[p.path] = c
+		}
+		return c
+	}
+	key := p.key()
+	for _, c := range n.dynamics {
+		if c.part.key() == key {
+			return c
+		}
+	}
+	c := newNode(p)
+	n.dynamics = append(n.dynamics, c)
+	return c
+}
+
+// mark 會在路由經過此節點時更新子樹中排名最高的路由。
+func (n *node) mark(route *Route, rank int) {
+	if n.bestRank == -1 {
+		n.best = route
+		n.bestRank = rank
+	}
+}
+
+// sort 會依照子樹中最佳的排名重新排列擷取群組子節點，讓比對能夠盡早略過不可能勝出的分支。
+func (n *node) sort() {
+	for i := 1; i < len(n.dynamics); i++ {
+		for j := i; j > 0 && n.dynamics[j].bestRank < n.dynamics[j-1].bestRank; j-- {
+			n.dynamics[j], n.dynamics[j-1] = n.dynamics[j-1], n.dynamics[j]
+		}
+	}
+	for _, c := range n.statics {
+		c.sort()
+	}
+	for _, c := range n.dynamics {
+		c.sort()
+	}
+}
+
+// matchPool 是重複使用的路由樹比對狀態，這讓擷取變數的暫存切片能夠在請求之間共用。
+var matchPool = sync.Pool{
+	New: func() interface{} {
+		return new(treeMatch)
+	},
+}
+
+// lookup 會以請求網址的片段搜尋路由樹，並回傳排名最高的相符路由，其擷取變數則會被寫入 `params` 之中，
+// 而規則的轉換結果則會被寫入 `values`（能夠是 `nil`）。比對規則與逐一掃描動態路由時完全相同，只是共享開頭的路由僅需要比對一次。
+func (n *node) lookup(components []string, originals []string, params *RouteParams, values *[]conversion) *Route {
+	*params = (*params)[:0]
+	if values != nil {
+		*values = (*values)[:0]
+	}
+	if len(components) == 0 || n.best == nil {
+		return nil
+	}
+	m := matchPool.Get().(*treeMatch)
+	*m = treeMatch{
+		components: components,
+		originals:  originals,
+		stack:      m.stack[:0],
+		rank:       -1,
+		vars:       m.vars[:0],
+		unescape:   n.best.routeGroup.router.UseRawPath,
+	}
+	m.descend(n, 0)
+	route := m.route
+	if route != nil {
+		params.reset(route.varNames)
+		for _, v := range m.vars {
+			params.set(v.name, v.value)
+			if values != nil && v.converts {
+				*values = append(*values, conversion{v.name, v.converted})
+			}
+		}
+	}
+	*m = treeMatch{stack: m.stack[:0], vars: m.vars[:0]}
+	matchPool.Put(m)
+	return route
+}
+
+// beats 表示指定排名是否比目前找到的路由還要優先。
+func (m *treeMatch) beats(rank int) bool {
+	return m.rank == -1 || rank < m.rank
+}
+
+// accept 會以指定的路由作為比對結果，並保存目前分支上的擷取變數。
+func (m *treeMatch) accept(route *Route, rank int, extra ...capture) {
+	if !m.beats(rank) {
+		return
+	}
+	m.route = route
+	m.rank = rank
+	m.vars = append(append(m.vars[:0], m.stack...), extra...)
+}
+
+// descend 會以網址中第 `index` 個片段比對指定節點底下可能相符的子節點。
+func (m *treeMatch) descend(n *node, index int) {
+	if c, ok := n.statics[m.components[index]]; ok {
+		m.walk(c, index)
+	}
+	for _, c := range n.dynamics {
+		m.walk(c, index)
+	}
+}
+
+// walk 會以網址中第 `index` 個片段比對指定節點，並繼續往下比對子節點。
+func (m *treeMatch) walk(n *node, index int) {
+	if !m.beats(n.bestRank) {
+		return
+	}
+	component := m.components[index]
+	isLastComponent := index == len(m.components)-1
+	p := n.part
+
+	if p.isCaptureGroup {
+		if p.prefix != "" {
+			if !strings.HasPrefix(component, p.prefix) {
+				return
+			}
+			component = strings.TrimPrefix(component, p.prefix)
+		}
+		if p.suffix != "" {
+			if !strings.HasSuffix(component, p.suffix) {
+				return
+			}
+			component = strings.TrimSuffix(component, p.suffix)
+		}
+		if p.prefix != "" || p.suffix != "" {
+			if !p.isOptional && !p.isRegExp && component == "" {
+				return
+			}
+		}
+		// 在此結束的任意路由會直接吃下剩餘的所有片段。
+		if n.route != nil && p.isAny() {
+			m.accept(n.route, n.rank, capture{name: p.name, value: strings.Join(m.originals[index:], "/")})
+		}
+		value := p.original(m.originals[index])
+		c := capture{name: p.name, value: value}
+		if p.isRegExp {
+			if (p.isOptional && component != "") || !p.isOptional {
+				v, ok := p.check(component, value, m.unescape)
+				if !ok {
+					return
+				}
+				c.converted, c.converts = v, p.converts()
+			}
+		}
+		m.stack = append(m.stack, c)
+	} else if p.path != component {
+		return
+	}
+
+	if n.route != nil && isLastComponent && !p.isAny() {
+		m.accept(n.route, n.rank)
+	}
+	// 可選的靜態片段同樣能在網址已經到底時被省略。
+	for _, c := range n.statics {
+		if c.optional != nil && isLastComponent && component != "" && m.beats(c.optionalRank) {
+			m.accept(c.optional, c.optionalRank)
+		}
+	}
+	for _, c := range n.dynamics {
+		if component == "" || !m.beats(c.bestRank) {
+			continue
+		}
+		// 如果下個片段是可選的，且網址已經到底的話，那麼這整個子樹的路由都算符合。
+		if c.part.isOptional && isLastComponent {
+			m.accept(c.best, c.bestRank)
+			continue
+		}
+		// 如果下個片段是任意規則，那麼剩下的網址都會是這個片段的內容。
+		if c.part.isAny() {
+			m.accept(c.best, c.bestRank, capture{name: c.part.name, value: strings.Join(m.originals[index+1:], "/")})
+		}
+	}
+	if !isLastComponent {
+		m.descend(n, index+1)
+	}
+	if p.isCaptureGroup {
+		m.stack = m.stack[:len(m.stack)-1]
+	}
+}
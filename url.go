@@ -0,0 +1,149 @@
+package davai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// URLOptions 是反向產生路由時的選項。
+type URLOptions struct {
+	// Vars 是路由中的變數。
+	Vars map[string]string
+	// Query 是要附加至網址後的查詢參數，同個鍵名可以有多個值並會依照傳入的順序排列。
+	Query url.Values
+	// Fragment 是要附加至網址後的片段識別符號（`#` 之後的內容），這會經過網址編碼。
+	Fragment string
+	// ExtraVarsAsQuery 會將 `Vars` 中沒有被路由所使用的變數移至查詢參數中，預設這些變數會被忽略。
+	ExtraVarsAsQuery bool
+	// Absolute 會產生帶有協定與主機名稱的絕對網址，這在電子郵件或是 OAuth 的重新導向網址中非常有用。
+	Absolute bool
+	// Request 是目前的請求，產生絕對網址時會以此推斷協定與主機名稱，並且會採用 `X-Forwarded-Proto` 與 `X-Forwarded-Host` 標頭。
+	// 這些標頭能由客戶端任意偽造，因此僅應該在路由器位於可信任的反向代理伺服器之後時使用，否則請改為設置 `BaseURL`。
+	Request *http.Request
+}
+
+// BuildURL 可以依照傳入的路由名稱與選項來反向產生定義好的路由，除了路由變數之外還能夠附加查詢參數與片段識別符號。
+// 查詢參數會依照鍵名排序，因此相同的選項總是會產生相同的網址。路由無法產生時所回傳的錯誤與 `URL` 相同。
+func (r *Router) BuildURL(name string, options URLOptions) (string, error) {
+	v, ok := r.current().names[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrRouteNotFound, name)
+	}
+	path, err := v.generate(options.Vars)
+	if err != nil {
+		return "", err
+	}
+	query := make(url.Values, len(options.Query))
+	for k, values := range options.Query {
+		query[k] = append([]string(nil), values...)
+	}
+	if options.ExtraVarsAsQuery {
+		for k, value := range options.Vars {
+			if _, ok := v.defaultCaptureVars[k]; !ok {
+				query.Add(k, value)
+			}
+		}
+	}
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+	if options.Fragment != "" {
+		path += "#" + (&url.URL{Fragment: options.Fragment}).EscapedFragment()
+	}
+	if !options.Absolute {
+		return path, nil
+	}
+	base, err := r.baseURL(options.Request)
+	if err != nil {
+		return "", err
+	}
+	return base + path, nil
+}
+
+// baseURL 會回傳產生絕對網址時所使用的基礎網址，有傳入請求時會以請求推斷，否則會使用路由器的 `BaseURL` 設定。
+func (r *Router) baseURL(req *http.Request) (string, error) {
+	if req == nil {
+		if r.BaseURL == "" {
+			return "", ErrBaseURLNotFound
+		}
+		return strings.TrimSuffix(r.BaseURL, "/"), nil
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if v := forwarded(req, "X-Forwarded-Proto"); v != "" {
+		scheme = strings.ToLower(v)
+	}
+	host := req.Host
+	if v := forwarded(req, "X-Forwarded-Host"); v != "" {
+		host = v
+	}
+	if host == "" {
+		return "", fmt.Errorf("%w: the request has no host", ErrBaseURLNotFound)
+	}
+	return scheme + "://" + host, nil
+}
+
+// forwarded 會回傳反向代理伺服器所設置的標頭值，經過多層代理時只會採用最前面（最接近客戶端）的值。
+func forwarded(req *http.Request, key string) string {
+	v := req.Header.Get(key)
+	if i := strings.Index(v, ","); i != -1 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
+
+// FuncMap 會回傳能夠在 `html/template` 與 `text/template` 中使用的模板函式，其中包含了：
+//
+//	{{ url "Product" "type" "large" "id" "152" }}
+//	{{ absURL "Product" "type" "large" "id" "152" }}
+//
+// 路由名稱之後是成對的鍵名與值，不屬於路由變數的鍵名會被作為查詢參數（同個鍵名可以重複傳入），而 `#` 鍵名則是片段識別符號。
+// `absURL` 會以路由器的 `BaseURL` 產生絕對網址。無法產生路由時會回傳錯誤，因此模板會停止執行並回傳該錯誤而不是發生 panic。
+func (r *Router) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"url": func(name string, args ...interface{}) (string, error) {
+			return r.templateURL(name, false, args)
+		},
+		"absURL": func(name string, args ...interface{}) (string, error) {
+			return r.templateURL(name, true, args)
+		},
+	}
+}
+
+// templateURL 會將模板函式所傳入的成對參數轉換成選項並產生路由。
+func (r *Router) templateURL(name string, absolute bool, args []interface{}) (string, error) {
+	if len(args)%2 != 0 {
+		return "", fmt.Errorf("%w: route %q got %d arguments", ErrInvalidURLArgs, name, len(args))
+	}
+	options := URLOptions{
+		Vars:     make(map[string]string),
+		Query:    make(url.Values),
+		Absolute: absolute,
+	}
+	// 路由不存在時就交由 `BuildURL` 回傳錯誤。
+	var captures map[string]string
+	if v, ok := r.current().names[name]; ok {
+		captures = v.defaultCaptureVars
+	}
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return "", fmt.Errorf("%w: route %q got %v as a key", ErrInvalidURLArgs, name, args[i])
+		}
+		value := fmt.Sprint(args[i+1])
+		switch _, ok := captures[key]; {
+		case key == "#":
+			options.Fragment = value
+		case ok:
+			options.Vars[key] = value
+		default:
+			options.Query.Add(key, value)
+		}
+	}
+	return r.BuildURL(name, options)
+}
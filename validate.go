@@ -0,0 +1,116 @@
+package davai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Validate 會檢查所有已定義的路由，並回傳所有發現的錯誤，例如未定義的規則、格式錯誤的花括號、
+// 重複的變數名稱、沒有處理函式的路由與重複的路由名稱。每個錯誤都能以 `errors.Is` 判斷其種類。
+// 啟用 `StrictRoutes` 時也會回傳路由之間的衝突。`Run` 與 `RunTLS` 會在啟動伺服器之前呼叫此函式，並在有錯誤時直接回傳而不會開始服務。
+func (r *Router) Validate() error {
+	var errs []error
+	for _, route := range r.current().routes {
+		errs = append(errs, route.validate()...)
+	}
+	if r.StrictRoutes {
+		for _, v := range r.Conflicts() {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrRouteConflict, v))
+		}
+	}
+	return joinErrors(errs)
+}
+
+// multiError 是多個錯誤的集合，每個錯誤都能夠透過 `errors.Is` 與 `errors.As` 判斷。
+// 這和 Go 1.20 的 `errors.Join` 相同，但能夠在較舊的 Go 版本中使用。
+type multiError []error
+
+// joinErrors 會將多個錯誤合併成單個錯誤，沒有任何錯誤時會回傳 `nil`。
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return multiError(errs)
+}
+
+// Error 會以換行分隔所有錯誤的訊息。
+func (e multiError) Error() string {
+	messages := make([]string, len(e))
+	for i, v := range e {
+		messages[i] = v.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Is 會回報是否有任何一個錯誤符合 `target`。
+func (e multiError) Is(target error) bool {
+	for _, v := range e {
+		if errors.Is(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 會將第一個符合 `target` 型態的錯誤指派給 `target`。
+func (e multiError) As(target interface{}) bool {
+	for _, v := range e {
+		if errors.As(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 會回傳定義此路由時所發現的錯誤，以及沒有處理函式的錯誤。
+func (r *Route) validate() []error {
+	errs := append([]error(nil), r.errs...)
+	if !r.hasHandler() {
+		errs = append(errs, fmt.Errorf("%w: route %s", ErrHandlerNotFound, r))
+	}
+	return errs
+}
+
+// hasHandler 表示此路由是否有一個非 `nil` 的處理函式，並且沒有無法辨識或是 `nil` 的中介軟體。
+func (r *Route) hasHandler() bool {
+	var found bool
+	for _, v := range r.rawHandlers {
+		if v == nil || (reflect.ValueOf(v).Kind() == reflect.Func && reflect.ValueOf(v).IsNil()) {
+			return false
+		}
+		switch v.(type) {
+		case func(http.Handler) http.Handler, middleware:
+		case func(http.ResponseWriter, *http.Request), http.Handler:
+			found = true
+		default:
+			return false
+		}
+	}
+	return found
+}
+
+// checkSegment 會檢查路由片段中的花括號是否成對，且擷取群組中的規則與變數名稱不是空的。
+func checkSegment(v string) error {
+	opening := strings.Count(v, "{")
+	closing := strings.Count(v, "}")
+	if opening == 0 && closing == 0 {
+		return nil
+	}
+	if opening != 1 || closing != 1 || strings.Index(v, "{") > strings.Index(v, "}") {
+		return fmt.Errorf("unbalanced braces in %q", v)
+	}
+	group := strings.TrimSuffix(v[strings.Index(v, "{")+1:strings.Index(v, "}")], "?")
+	details := strings.Split(group, ":")
+	if len(details) > 2 {
+		return fmt.Errorf("too many colons in %q", v)
+	}
+	for _, d := range details {
+		if d == "" || strings.Contains(d, "?") {
+			return fmt.Errorf("an empty rule or variable name in %q", v)
+		}
+	}
+	return nil
+}
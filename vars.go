@@ -0,0 +1,155 @@
+package davai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VarError 是無法將路由變數轉換成指定型態時所回傳的錯誤，這通常是客戶端的錯誤，
+// 因此能夠在統一的錯誤處理函式中透過 `errors.As` 判斷並以 `StatusCode` 回應。
+type VarError struct {
+	// Source 是變數的來源，空字串表示路由變數，而透過 `BindVars` 綁定時也可能是 `query` 或 `header`。
+	Source string
+	// Name 是變數的名稱。
+	Name string
+	// Value 是變數原本的內容。
+	Value string
+	// Type 是欲轉換的型態，例如 `int` 或 `uuid`。
+	Type string
+	// Err 是轉換時所發生的錯誤，沒有擷取到變數時會是 `ErrVarEmpty`。
+	Err error
+}
+
+// Error 會回傳帶有變數名稱與內容的錯誤訊息。
+func (e *VarError) Error() string {
+	noun := "variable"
+	switch e.Source {
+	case sourceQuery:
+		noun = "query parameter"
+	case sourceHeader:
+		noun = "header"
+	}
+	if errors.Is(e.Err, ErrVarEmpty) {
+		return fmt.Sprintf("davai: the %s %q is required as %s", noun, e.Name, e.Type)
+	}
+	return fmt.Sprintf("davai: the %s %q with value %q is not a valid %s: %v", noun, e.Name, e.Value, e.Type, e.Err)
+}
+
+// Unwrap 會回傳轉換時所發生的錯誤。
+func (e *VarError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode 會回傳此錯誤所對應的 HTTP 狀態碼，路由變數錯誤總是 400 Bad Request。
+func (e *VarError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Values 會回傳以規則轉換函式轉換後的路由變數，只有使用了帶有轉換函式的規則且有擷取到內容的變數才會出現在其中。
+// 比對路由時就已經轉換過的變數會直接沿用，而不會再次呼叫轉換函式。
+func Values(r *http.Request) map[string]interface{} {
+	p := requestParamsOf(r)
+	if p == nil {
+		return nil
+	}
+	p.valuesOnce.Do(func() {
+		p.values = p.route.convert(p.params, p.converted)
+	})
+	return p.values
+}
+
+// varValue 會取得指定的路由變數，並在沒有擷取到時回傳 `VarError`。
+func varValue(r *http.Request, name string, typ string) (string, error) {
+	v := Params(r).Get(name)
+	if v == "" {
+		return "", &VarError{Name: name, Type: typ, Err: ErrVarEmpty}
+	}
+	return v, nil
+}
+
+// VarInt 會將指定的路由變數轉換成 `int`。
+func VarInt(r *http.Request, name string) (int, error) {
+	v, err := varValue(r, name, "int")
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &VarError{Name: name, Value: v, Type: "int", Err: err}
+	}
+	return i, nil
+}
+
+// VarInt64 會將指定的路由變數轉換成 `int64`。
+func VarInt64(r *http.Request, name string) (int64, error) {
+	v, err := varValue(r, name, "int64")
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, &VarError{Name: name, Value: v, Type: "int64", Err: err}
+	}
+	return i, nil
+}
+
+// VarBool 會將指定的路由變數轉換成 `bool`，可接受的內容與 `strconv.ParseBool` 相同。
+func VarBool(r *http.Request, name string) (bool, error) {
+	v, err := varValue(r, name, "bool")
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &VarError{Name: name, Value: v, Type: "bool", Err: err}
+	}
+	return b, nil
+}
+
+// VarTime 會依照傳入的格式將指定的路由變數轉換成 `time.Time`，例如 `VarTime(r, "date", "2006-01-02")`。
+func VarTime(r *http.Request, name string, layout string) (time.Time, error) {
+	v, err := varValue(r, name, "time")
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		return time.Time{}, &VarError{Name: name, Value: v, Type: "time", Err: err}
+	}
+	return t, nil
+}
+
+// VarUUID 會驗證指定的路由變數是否為 `xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx` 格式的 UUID，並回傳小寫的標準格式。
+func VarUUID(r *http.Request, name string) (string, error) {
+	v, err := varValue(r, name, "uuid")
+	if err != nil {
+		return "", err
+	}
+	if !isUUID(v) {
+		return "", &VarError{Name: name, Value: v, Type: "uuid", Err: errors.New("invalid format")}
+	}
+	return strings.ToLower(v), nil
+}
+
+// isUUID 表示傳入的字串是否為標準格式的 UUID。
+func isUUID(v string) bool {
+	if len(v) != 36 {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}